@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	log "github.com/sirupsen/logrus"
+)
+
+// runFakeClamd starts a fake clamd for demo setups until SIGINT or SIGTERM is received.
+// It returns the exit code of the process.
+func runFakeClamd(args []string) int {
+	flags := flag.NewFlagSet("fake-clamd", flag.ContinueOnError)
+	network := flags.String("network", "tcp", "Network mode to listen on, typically tcp or unix (socket)")
+	address := flags.String("address", "localhost:3310", "Address to listen on")
+	latency := flags.Duration("latency", 0, "Delay of every reply")
+	version := flags.String("version", clamavtest.DefaultVersion, "Reply to VERSION")
+	tlsCert := flags.String("tls-cert", "", "Certificate to listen with TLS, like clamd behind stunnel (keep empty to disable)")
+	tlsKey := flags.String("tls-key", "", "Key of -tls-cert")
+	tlsClientCA := flags.String("tls-client-ca", "", "CA bundle verifying required client certificates (keep empty to disable)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	config, err := fakeClamdTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+	if err != nil {
+		log.Error("Error loading TLS configuration: ", err)
+		return 2
+	}
+
+	server, err := clamavtest.NewTLSServer(*network, *address, config)
+	if err != nil {
+		log.Error("Error starting fake clamd: ", err)
+		return 1
+	}
+	server.SetLatency(*latency)
+	server.SetReply("VERSION", *version)
+	log.Infof("Fake clamd is listening on %s %s", server.Network, server.Address)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Info("Fake clamd is stopping...")
+	if err = server.Close(); err != nil {
+		log.Error("Error stopping fake clamd: ", err)
+		return 1
+	}
+	return 0
+}
+
+// fakeClamdTLSConfig creates the TLS configuration of the fake clamd, nil without certificate
+func fakeClamdTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if clientCAFile != "" {
+		ca, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		config.ClientCAs.AppendCertsFromPEM(ca)
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
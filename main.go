@@ -18,17 +18,26 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/api"
 	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamdconf"
 	"github.com/shakapark/clamav-prometheus-exporter/pkg/collector"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/events"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/notify"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/otlp"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/scheduler"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -38,10 +47,123 @@ var (
 	address        string
 	port           int
 	network        string
+	target         string
 	reportScanPath string
 	logLevel       string
+
+	clamdConfig              string
+	clamdConfigCheckInterval time.Duration
+	freshclamConfig          string
+	configPolicy             string
+
+	processMetrics   bool
+	clamdPidFile     string
+	clamdProcessName string
+	procfsPath       string
+	cgroupMemory     bool
+	cgroupfsPath     string
+
+	scanAPI       bool
+	scanMaxLength int64
+	scanChunkSize = positiveInt(64 * 1024)
+	scanTimeout   time.Duration
+
+	probeAPI bool
+
+	scanSchedule string
+	scanPaths    string
+	scanMode     string
+
+	adminTokenFile     string
+	reloadTimeout      time.Duration
+	reloadPollInterval time.Duration
+
+	otlpEndpoint string
+	otlpProtocol string
+	otlpInterval time.Duration
+
+	textfileOutput   string
+	textfileInterval time.Duration
+
+	webhooks           stringList
+	webhookDedupWindow time.Duration
+	webhookRetries     int
+	webhookBackoff     time.Duration
+
+	eventLog              string
+	eventLogFile          string
+	eventLogMaxSize       int64
+	eventLogMaxBackups    int
+	eventLogSyslogAddress string
+
+	cacheTTL     time.Duration
+	pollInterval time.Duration
+
+	clamavTimezone    string
+	clamavDatabaseDir string
+
+	memstatsLegacyScaling bool
+
+	clamavRetries             int
+	clamavRetryBackoff        = nonNegativeDuration(100 * time.Millisecond)
+	clamavCircuitFailures     int
+	clamavCircuitOpenDuration time.Duration
+
+	clamavPoolSize        int
+	clamavPoolIdleTimeout time.Duration
+	clamavPoolMaxLifetime time.Duration
 )
 
+// stringList is a flag which can be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// nonNegativeDuration is a duration flag which can't be negative
+type nonNegativeDuration time.Duration
+
+func (d *nonNegativeDuration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *nonNegativeDuration) Set(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if duration < 0 {
+		return fmt.Errorf("negative duration %s", value)
+	}
+	*d = nonNegativeDuration(duration)
+	return nil
+}
+
+// positiveInt is an int flag which must be greater than 0
+type positiveInt int
+
+func (i *positiveInt) String() string {
+	return strconv.Itoa(int(*i))
+}
+
+func (i *positiveInt) Set(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	if n <= 0 {
+		return fmt.Errorf("%d is not positive", n)
+	}
+	*i = positiveInt(n)
+	return nil
+}
+
 func setLogLevel(level string) {
 	switch strings.ToUpper(strings.TrimSpace(level)) {
 	case "TRACE":
@@ -63,37 +185,416 @@ func setLogLevel(level string) {
 	log.Debug("Log level is: ", log.GetLevel())
 }
 
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// legacyTarget builds the target URL from -network, -clamav-address and -clamav-port.
+// tcp4 and tcp6, accepted by net.Dial, are mapped to tcp, the IP family then follows the address.
+func legacyTarget(network, address string, port int) string {
+	switch strings.ToLower(network) {
+	case "tcp", "tcp4", "tcp6":
+		// IPv6 addresses may be given with or without brackets
+		return "tcp://" + net.JoinHostPort(strings.Trim(address, "[]"), strconv.Itoa(port))
+	}
+	return strings.ToLower(network) + "://" + address
+}
+
+// clamdConfigTarget returns the first target clamd listens on according to config which answers PING,
+// e.g. the TCPSocket when the LocalSocket isn't mounted in the container of the exporter.
+// When none answers, e.g. while clamd is starting, the first target is returned.
+func clamdConfigTarget(config *clamdconf.Config) (clamav.Target, error) {
+	targets, err := config.Targets()
+	if err != nil {
+		return clamav.Target{}, err
+	}
+	for _, target := range targets {
+		client, err := clamav.NewFromTarget(target)
+		if err != nil {
+			return clamav.Target{}, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err = client.SendContext(ctx, commands.PING)
+		cancel()
+		if err == nil {
+			return target, nil
+		}
+		log.Debug("clamd doesn't answer on ", target, ": ", err)
+	}
+	log.Warn("clamd doesn't answer on any target of clamd configuration, using ", targets[0])
+	return targets[0], nil
+}
+
+// configureClient sets the retries, circuit breaker and connection pool of a client from the flags
+func configureClient(client *clamav.Client) {
+	client.SetRetries(clamavRetries, time.Duration(clamavRetryBackoff))
+	client.SetCircuitBreaker(clamavCircuitFailures, clamavCircuitOpenDuration)
+	client.SetPool(clamavPoolSize, clamavPoolIdleTimeout, clamavPoolMaxLifetime)
+}
+
 func init() {
 	log.SetFormatter(&log.JSONFormatter{})
 
 	flag.StringVar(&address, "clamav-address", "localhost", "ClamAV address to use")
 	flag.IntVar(&port, "clamav-port", 3310, "ClamAV port to use")
 	flag.StringVar(&network, "network", "tcp", "Network mode to use, typically tcp or unix (socket)")
+	flag.StringVar(&target, "clamav-target", "", "ClamAV URL replacing -clamav-address, -clamav-port and -network, e.g. tcp://[::1]:3310, unix:///run/clamav/clamd.ctl, unix-abstract://clamd or tls://clamd:3310")
+	flag.StringVar(&clamdConfig, "clamd.config", "", "Path to clamd.conf, exporting its limits, and connecting to its LocalSocket or TCPSocket when -clamav-target is empty, e.g. /etc/clamav/clamd.conf (keep empty to disable)")
+	flag.DurationVar(&clamdConfigCheckInterval, "clamd.config-check-interval", 30*time.Second, "Interval between checks of -clamd.config and -freshclam.config for changes")
+	flag.StringVar(&freshclamConfig, "freshclam.config", "", "Path to freshclam.conf, checked against -config.policy, e.g. /etc/clamav/freshclam.conf")
+	flag.StringVar(&configPolicy, "config.policy", "", "YAML file of the settings required in -clamd.config and -freshclam.config, reported on /config/policy (keep empty to disable)")
+	flag.BoolVar(&processMetrics, "process-metrics", false, "Export CPU, memory, file descriptors and threads of the ClamAV process from procfs, ClamAV must run on the same host or in the same PID namespace")
+	flag.StringVar(&clamdPidFile, "clamd.pid-file", "", "PID file of ClamAV for -process-metrics and -cgroup-memory, PidFile of -clamd.config when empty, the process is found by -clamd.process-name without PID file")
+	flag.StringVar(&clamdProcessName, "clamd.process-name", collector.DefaultProcessName, "Name of the ClamAV process for -process-metrics and -cgroup-memory without PID file")
+	flag.StringVar(&procfsPath, "path.procfs", "/proc", "procfs mountpoint for -process-metrics and -cgroup-memory")
+	flag.BoolVar(&cgroupMemory, "cgroup-memory", false, "Export the memory limit and usage of the cgroup of the ClamAV process, and the memory headroom of database reloads")
+	flag.StringVar(&cgroupfsPath, "path.cgroupfs", "/sys/fs/cgroup", "cgroupfs mountpoint for -cgroup-memory")
 	flag.StringVar(&reportScanPath, "report-scan-path", "", "Path to clamscan report file (keep empty if you don't use clamscan)")
+	flag.BoolVar(&scanAPI, "scan-api", false, "Enable the POST /scan endpoint streaming request bodies to ClamAV with INSTREAM")
+	flag.Int64Var(&scanMaxLength, "scan-max-length", 25*1024*1024, "Maximum size in bytes of a stream sent to ClamAV, should match StreamMaxLength in clamd.conf")
+	flag.Var(&scanChunkSize, "scan-chunk-size", "Size in bytes of the chunks sent to ClamAV with INSTREAM, as a positive `int`")
+	flag.DurationVar(&scanTimeout, "scan-timeout", time.Minute, "Timeout of a request to the scan endpoint")
+	flag.BoolVar(&probeAPI, "probe-api", false, "Enable the /probe?target= endpoint serving the metrics of any ClamAV given as URL")
+	flag.StringVar(&scanSchedule, "scan-schedule", "", "Cron expression scheduling scans of -scan-paths by ClamAV (keep empty to disable)")
+	flag.StringVar(&scanPaths, "scan-paths", "", "Comma separated list of paths, as seen by ClamAV, to scan on -scan-schedule")
+	flag.StringVar(&scanMode, "scan-mode", "contscan", "Command used for scheduled scans. (options: contscan, multiscan, allmatchscan)")
+	flag.StringVar(&adminTokenFile, "admin-token-file", "", "File containing the bearer token enabling the POST /admin/reload endpoint (keep empty to disable)")
+	flag.DurationVar(&reloadTimeout, "reload-timeout", 5*time.Minute, "Maximum time to wait for the database version to change after a reload")
+	flag.DurationVar(&reloadPollInterval, "reload-poll-interval", time.Second, "Interval between VERSION queries while waiting for a reload")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "", "URL of an OTLP receiver to push metrics to, e.g. http://otel-collector:4318/v1/metrics (keep empty to disable)")
+	flag.StringVar(&otlpProtocol, "otlp-protocol", "http", "OTLP protocol to use. (options: http, grpc)")
+	flag.DurationVar(&otlpInterval, "otlp-interval", 30*time.Second, "Interval between pushes of metrics to the OTLP receiver")
+	flag.StringVar(&textfileOutput, "output.textfile", "", "Write metrics to this file for the textfile collector of node_exporter instead of listening on :9810")
+	flag.DurationVar(&textfileInterval, "output.textfile-interval", time.Minute, "Interval between writes of -output.textfile")
+	flag.Var(&webhooks, "webhook", "Webhook notified of detections as format=url, format being generic, slack or alertmanager (can be repeated)")
+	flag.DurationVar(&webhookDedupWindow, "webhook-dedup-window", time.Hour, "Identical detections are only notified once during this window")
+	flag.IntVar(&webhookRetries, "webhook-retries", 3, "Number of retries of a failed webhook delivery")
+	flag.DurationVar(&webhookBackoff, "webhook-backoff", time.Second, "Initial delay between retries of a failed webhook delivery, doubled on each retry")
+	flag.StringVar(&eventLog, "event-log", "", "Write detections and scan summaries as JSON events, apart from the logs. (options: stdout, file, syslog) (keep empty to disable)")
+	flag.StringVar(&eventLogFile, "event-log-file", "", "Path to the event log file with -event-log=file")
+	flag.Int64Var(&eventLogMaxSize, "event-log-max-size", 100*1024*1024, "Size in bytes after which the event log file is rotated (0 to disable rotation)")
+	flag.IntVar(&eventLogMaxBackups, "event-log-max-backups", 5, "Number of rotated event log files to keep")
+	flag.StringVar(&eventLogSyslogAddress, "event-log-syslog-address", "unix:///dev/log", "Syslog address with -event-log=syslog, e.g. tcp://syslog:514, udp://syslog:514 or unix:///dev/log")
+	flag.DurationVar(&cacheTTL, "cache-ttl", 0, "Serve ClamAV replies from a cache during this time, concurrent scrapes share a single query to ClamAV (0 to disable)")
+	flag.DurationVar(&pollInterval, "poll-interval", 0, "Query ClamAV in the background on this interval, scrapes are served from the last replies (0 to query on scrape)")
+	flag.IntVar(&clamavRetries, "clamav-retries", 2, "Number of retries of PING, STATS and VERSION when ClamAV fails to answer")
+	flag.Var(&clamavRetryBackoff, "clamav-retry-backoff", "Initial delay between retries of a command to ClamAV, doubled on each retry, as a non-negative `duration`")
+	flag.IntVar(&clamavCircuitFailures, "clamav-circuit-failures", 5, "Consecutive failed commands after which ClamAV isn't queried during -clamav-circuit-open-duration (0 to disable)")
+	flag.DurationVar(&clamavCircuitOpenDuration, "clamav-circuit-open-duration", 30*time.Second, "Time during which ClamAV isn't queried after -clamav-circuit-failures, before trying it again")
+	flag.IntVar(&clamavPoolSize, "clamav-pool-size", 2, "Maximum number of sessions kept open to ClamAV for PING, STATS and VERSION (0 to open a connection per command)")
+	flag.DurationVar(&clamavPoolIdleTimeout, "clamav-pool-idle-timeout", 20*time.Second, "Close the sessions idle for this time, should be lower than IdleTimeout of clamd.conf")
+	flag.DurationVar(&clamavPoolMaxLifetime, "clamav-pool-max-lifetime", 5*time.Minute, "Close the sessions open for this time")
+	flag.StringVar(&clamavTimezone, "clamav-timezone", "Local", "Time zone of ClamAV, used to read the database date of VERSION, e.g. UTC or Europe/Paris")
+	flag.StringVar(&clamavDatabaseDir, "clamav-database-dir", "", "ClamAV database directory, used for the database age when VERSION has no date (keep empty to disable)")
+	flag.BoolVar(&memstatsLegacyScaling, "memstats-legacy-scaling", false, "Export memory stats multiplied by 1024 regardless of their unit, as before they were converted to bytes (deprecated)")
 	flag.StringVar(&logLevel, "log-level", "info", "Set the level of logging. (options: trace, debug, info, warn, error, fatal, panic)")
+}
 
+func main() {
 	flag.Parse()
-
 	setLogLevel(logLevel)
-}
 
-func main() {
+	switch flag.Arg(0) {
+	case "push":
+		os.Exit(runPush(flag.Args()[1:]))
+	case "fake-clamd":
+		os.Exit(runFakeClamd(flag.Args()[1:]))
+	}
+
 	log.Info("Server is starting...")
 	log.Infof("Version: %s", version)
 
-	if strings.EqualFold(network, "tcp") {
-		address = fmt.Sprintf("%s:%d", address, port)
+	var clamdConfiguration *clamdconf.Config
+	var err error
+	if clamdConfig != "" {
+		if clamdConfiguration, err = clamdconf.Load(clamdConfig); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var clamdTarget clamav.Target
+	switch {
+	case target != "":
+		clamdTarget, err = clamav.ParseTarget(target)
+	case clamdConfiguration != nil:
+		clamdTarget, err = clamdConfigTarget(clamdConfiguration)
+	default:
+		clamdTarget, err = clamav.ParseTarget(legacyTarget(network, address, port))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Info("ClamAV target: ", clamdTarget)
+	client, err := clamav.NewFromTarget(clamdTarget)
+	if err != nil {
+		log.Fatal(err)
+	}
+	configureClient(client)
+
+	var policyCollector *collector.PolicyCollector
+	if configPolicy != "" {
+		policy, err := clamdconf.LoadPolicy(configPolicy)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if policy.Requires(clamdconf.ConfigClamd) && clamdConfig == "" {
+			log.Fatal("-config.policy has clamd settings, -clamd.config is required")
+		}
+		if policy.Requires(clamdconf.ConfigFreshclam) && freshclamConfig == "" {
+			log.Fatal("-config.policy has freshclam settings, -freshclam.config is required")
+		}
+		policyCollector = collector.NewPolicyCollector(policy)
+		policyCollector.SetConfig(clamdconf.ConfigClamd, clamdConfiguration)
+		log.Info("Configuration is checked against policy: ", configPolicy)
+	}
+
+	if freshclamConfig != "" {
+		if policyCollector == nil {
+			log.Warn("-freshclam.config is only used with -config.policy")
+		} else {
+			freshclamConfiguration, err := clamdconf.Load(freshclamConfig)
+			if err != nil {
+				log.Fatal(err)
+			}
+			policyCollector.SetConfig(clamdconf.ConfigFreshclam, freshclamConfiguration)
+			stopWatching := make(chan struct{})
+			defer close(stopWatching)
+			go clamdconf.Watch(freshclamConfig, clamdConfigCheckInterval, stopWatching, func(config *clamdconf.Config) {
+				policyCollector.SetConfig(clamdconf.ConfigFreshclam, config)
+			})
+		}
+	}
+
+	var processFinder *collector.ProcessFinder
+	if processMetrics || cgroupMemory {
+		pidFile := clamdPidFile
+		if pidFile == "" && clamdConfiguration != nil {
+			pidFile, _ = clamdConfiguration.Get("PidFile")
+		}
+		if processFinder, err = collector.NewProcessFinder(procfsPath, pidFile, clamdProcessName); err != nil {
+			log.Fatal(err)
+		}
+		if pidFile != "" {
+			log.Info("ClamAV process is found by PID file: ", pidFile)
+		} else {
+			log.Info("ClamAV process is found by name: ", clamdProcessName)
+		}
+	}
+	var processCollector *collector.ProcessCollector
+	if processMetrics {
+		processCollector = collector.NewProcessCollector(processFinder, clamdTarget.Endpoint())
+	}
+
+	var configCollector *collector.ConfigCollector
+	if clamdConfiguration != nil {
+		configCollector = collector.NewConfigCollector(clamdConfiguration)
+		current := clamdTarget.String()
+		stopWatching := make(chan struct{})
+		defer close(stopWatching)
+		go clamdconf.Watch(clamdConfig, clamdConfigCheckInterval, stopWatching, func(config *clamdconf.Config) {
+			configCollector.SetConfig(config)
+			if policyCollector != nil {
+				policyCollector.SetConfig(clamdconf.ConfigClamd, config)
+			}
+			if target != "" {
+				return
+			}
+			newTarget, err := clamdConfigTarget(config)
+			if err != nil {
+				log.Error("Error reading ClamAV target from clamd configuration: ", err)
+				return
+			}
+			if newTarget.String() == current {
+				return
+			}
+			if err = client.SetTarget(newTarget); err != nil {
+				log.Error(err)
+				return
+			}
+			log.Info("ClamAV target changed: ", newTarget)
+			current = newTarget.String()
+			if processCollector != nil {
+				processCollector.SetTarget(newTarget.Endpoint())
+			}
+		})
+	}
+
+	var listeners clamav.Listeners
+	if len(webhooks) > 0 {
+		var hooks []notify.Webhook
+		for _, value := range webhooks {
+			webhook, err := notify.ParseWebhook(value)
+			if err != nil {
+				log.Fatal(err)
+			}
+			hooks = append(hooks, webhook)
+		}
+		notifier := notify.New(hooks, webhookDedupWindow, webhookRetries, webhookBackoff)
+		notifier.Start()
+		prometheus.MustRegister(notifier)
+		listeners = append(listeners, notifier)
+		log.Infof("Detections are notified to %d webhooks", len(hooks))
+	}
+
+	if eventLog != "" {
+		eventLogger, err := events.New(events.Config{
+			Output:         eventLog,
+			FilePath:       eventLogFile,
+			FileMaxSize:    eventLogMaxSize,
+			FileMaxBackups: eventLogMaxBackups,
+			SyslogAddress:  eventLogSyslogAddress,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer eventLogger.Close()
+		listeners = append(listeners, eventLogger)
+		log.Info("Events are written to: ", eventLog)
 	}
 
-	client := clamav.New(address, network)
 	reportScan := clamav.NewScanReport(reportScanPath)
-	go reportScan.Tail()
+	reportScan.AddListener(listeners)
+	if reportScanPath != "" {
+		go reportScan.Tail()
+	}
+
+	var scanScheduler *scheduler.Scheduler
+	if scanSchedule != "" {
+		if reportScanPath != "" {
+			log.Warn("Scheduled scans and report file both update clamscan metrics")
+		}
+		scanScheduler, err = scheduler.New(*client, reportScan, scanMode, splitList(scanPaths))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = scanScheduler.Start(scanSchedule); err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Scans are scheduled with: ", scanSchedule)
+	}
 	clamavCollector, clamscanCollector := collector.New(*client, reportScan)
+	clamavCollector.SetCacheTTL(cacheTTL)
+
+	timezone, err := time.LoadLocation(clamavTimezone)
+	if err != nil {
+		log.Fatal("Error loading ClamAV time zone: ", err)
+	}
+	clamavCollector.SetDatabaseAgeSources(timezone, clamavDatabaseDir)
+	clamavCollector.SetLegacyMemoryScaling(memstatsLegacyScaling)
+	if configCollector != nil {
+		clamavCollector.SetConfigCollector(configCollector)
+	}
+	if cgroupMemory {
+		clamavCollector.SetCgroupMemory(collector.NewCgroupMemory(processFinder, cgroupfsPath))
+	}
+	if pollInterval > 0 {
+		if cacheTTL > 0 {
+			log.Warn("-cache-ttl is ignored with -poll-interval")
+		}
+		stopPolling := make(chan struct{})
+		defer close(stopPolling)
+		clamavCollector.StartPolling(pollInterval, stopPolling)
+		log.Info("ClamAV is polled every ", pollInterval)
+	}
 	prometheus.MustRegister(clamavCollector)
 	prometheus.MustRegister(clamscanCollector)
 
+	// Only the ClamAV metrics, without the ones of the exporter process
+	clamavRegistry := prometheus.NewRegistry()
+	clamavRegistry.MustRegister(clamavCollector, clamscanCollector)
+	if configCollector != nil {
+		prometheus.MustRegister(configCollector)
+		clamavRegistry.MustRegister(configCollector)
+	}
+	if policyCollector != nil {
+		prometheus.MustRegister(policyCollector)
+		clamavRegistry.MustRegister(policyCollector)
+	}
+	if processCollector != nil {
+		prometheus.MustRegister(processCollector)
+		clamavRegistry.MustRegister(processCollector)
+	}
+
+	var otlpExporter *otlp.Exporter
+	if otlpEndpoint != "" {
+		var err error
+		otlpExporter, err = otlp.New(context.Background(), otlp.Config{
+			Endpoint:       otlpEndpoint,
+			Protocol:       otlpProtocol,
+			Interval:       otlpInterval,
+			ServiceVersion: version,
+			ClamdTarget:    clamdTarget.Endpoint(),
+		}, clamavRegistry)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Metrics are pushed to OTLP endpoint: ", otlpEndpoint)
+	}
+
+	if textfileOutput != "" {
+		if scanAPI || adminTokenFile != "" {
+			log.Warn("Scan and admin APIs are not available with textfile output")
+		}
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		runTextfile(textfileOutput, textfileInterval, clamavRegistry, quit)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if scanScheduler != nil {
+			scanScheduler.Stop(ctx)
+		}
+
+		if otlpExporter != nil {
+			if err := otlpExporter.Shutdown(ctx); err != nil {
+				log.Error("Could not push metrics to OTLP endpoint on shutdown: ", err)
+			}
+		}
+		log.Info("Textfile output stopped")
+		return
+	}
+
 	router := http.NewServeMux()
 	router.Handle("/metrics", promhttp.Handler())
+	if scanAPI {
+		log.Info("Scan API is enabled on /scan")
+		scanHandler, err := api.NewScanHandler(*client, scanMaxLength, int(scanChunkSize), scanTimeout, clamavCollector, listeners)
+		if err != nil {
+			log.Fatal(err)
+		}
+		router.Handle("/scan", scanHandler)
+	}
+	if adminTokenFile != "" {
+		token, err := os.ReadFile(adminTokenFile)
+		if err != nil {
+			log.Fatal("Error reading admin token file: ", err)
+		}
+		if strings.TrimSpace(string(token)) == "" {
+			log.Fatal("Admin token file is empty: ", adminTokenFile)
+		}
+		log.Info("Admin API is enabled on /admin/reload")
+		router.Handle("/admin/reload", api.NewReloadHandler(*client, strings.TrimSpace(string(token)), reloadTimeout, reloadPollInterval, clamavCollector))
+	}
+	if policyCollector != nil {
+		log.Info("Policy report is enabled on /config/policy")
+		router.Handle("/config/policy", api.NewPolicyHandler(policyCollector))
+	}
+	if probeAPI {
+		log.Info("Probe API is enabled on /probe")
+		router.Handle("/probe", api.NewProbeHandler(configureClient, func(client clamav.Client) prometheus.Collector {
+			probeCollector, _ := collector.New(client, clamav.NewScanReport(""))
+			// The database directory is the one of -clamav-target, not of probed targets
+			probeCollector.SetDatabaseAgeSources(timezone, "")
+			probeCollector.SetLegacyMemoryScaling(memstatsLegacyScaling)
+			return probeCollector
+		}))
+	}
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%v", 9810),
@@ -119,6 +620,15 @@ func main() {
 		if err := server.Shutdown(ctx); err != nil {
 			log.Fatalf("Could not gracefully shutdown the server: %v\n", err)
 		}
+		// The running scan is recorded before the last OTLP push
+		if scanScheduler != nil {
+			scanScheduler.Stop(ctx)
+		}
+		if otlpExporter != nil {
+			if err := otlpExporter.Shutdown(ctx); err != nil {
+				log.Error("Could not push metrics to OTLP endpoint on shutdown: ", err)
+			}
+		}
 		close(done)
 	}()
 
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamdconf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPositiveInt(t *testing.T) {
+	chunkSize := positiveInt(64)
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Var(&chunkSize, "chunk-size", "")
+
+	for _, invalid := range []string{"0", "-1", "64K"} {
+		assert.Error(t, flags.Parse([]string{"-chunk-size", invalid}), invalid)
+	}
+	assert.Equal(t, positiveInt(64), chunkSize)
+	assert.NoError(t, flags.Parse([]string{"-chunk-size", "1"}))
+	assert.Equal(t, "1", chunkSize.String())
+}
+
+func TestNonNegativeDuration(t *testing.T) {
+	backoff := nonNegativeDuration(100 * time.Millisecond)
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Var(&backoff, "backoff", "")
+
+	assert.Error(t, flags.Parse([]string{"-backoff", "-1s"}))
+	assert.Error(t, flags.Parse([]string{"-backoff", "soon"}))
+	assert.Equal(t, 100*time.Millisecond, time.Duration(backoff))
+
+	assert.NoError(t, flags.Parse([]string{"-backoff", "0"}))
+	assert.Equal(t, time.Duration(0), time.Duration(backoff))
+	assert.NoError(t, flags.Parse([]string{"-backoff", "2s"}))
+	assert.Equal(t, "2s", backoff.String())
+}
+
+func TestClamdConfigTarget(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Address)
+	assert.NoError(t, err)
+	socket := filepath.Join(t.TempDir(), "clamd.sock")
+
+	// The LocalSocket isn't reachable, the TCPSocket is
+	config, err := clamdconf.Parse(strings.NewReader("LocalSocket " + socket + "\nTCPSocket " + port + "\nTCPAddr " + host + "\n"))
+	assert.NoError(t, err)
+	target, err := clamdConfigTarget(config)
+	assert.NoError(t, err)
+	assert.Equal(t, clamav.Target{Scheme: clamav.SchemeTCP, Address: server.Address}, target)
+
+	// Without any reachable target, the first one is used
+	server.Close()
+	target, err = clamdConfigTarget(config)
+	assert.NoError(t, err)
+	assert.Equal(t, clamav.Target{Scheme: clamav.SchemeUnix, Address: socket}, target)
+}
+
+func TestLegacyTarget(t *testing.T) {
+	for _, test := range []struct {
+		network string
+		address string
+		port    int
+		target  clamav.Target
+	}{
+		{"tcp", "localhost", 3310, clamav.Target{Scheme: clamav.SchemeTCP, Address: "localhost:3310"}},
+		{"TCP", "::1", 3310, clamav.Target{Scheme: clamav.SchemeTCP, Address: "[::1]:3310"}},
+		{"tcp4", "127.0.0.1", 3310, clamav.Target{Scheme: clamav.SchemeTCP, Address: "127.0.0.1:3310"}},
+		{"tcp6", "[::1]", 3311, clamav.Target{Scheme: clamav.SchemeTCP, Address: "[::1]:3311"}},
+		{"unix", "/run/clamav/clamd.sock", 3310, clamav.Target{Scheme: clamav.SchemeUnix, Address: "/run/clamav/clamd.sock"}},
+	} {
+		target, err := clamav.ParseTarget(legacyTarget(test.network, test.address, test.port))
+		assert.NoError(t, err, test.network)
+		assert.Equal(t, test.target, target, test.network)
+	}
+}
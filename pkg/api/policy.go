@@ -0,0 +1,38 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamdconf"
+	log "github.com/sirupsen/logrus"
+)
+
+// PolicyReporter checks clamd.conf and freshclam.conf against a policy
+type PolicyReporter interface {
+	PolicyReport() clamdconf.Report
+}
+
+// PolicyHandler serves the check of clamd.conf and freshclam.conf against a policy as JSON
+type PolicyHandler struct {
+	reporter PolicyReporter
+}
+
+// NewPolicyHandler creates a new PolicyHandler
+func NewPolicyHandler(reporter PolicyReporter) *PolicyHandler {
+	return &PolicyHandler{reporter: reporter}
+}
+
+// ServeHTTP satisfies http.Handler
+func (h *PolicyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.reporter.PolicyReport()); err != nil {
+		log.Error("Error writing policy report: ", err)
+	}
+}
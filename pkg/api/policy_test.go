@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamdconf"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/collector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyHandler(t *testing.T) {
+	policy, err := clamdconf.ParsePolicy(strings.NewReader("clamd:\n  ScanArchive: yes\nfreshclam:\n  DatabaseMirror: [mirror.internal]\n"))
+	assert.NoError(t, err)
+	reporter := collector.NewPolicyCollector(policy)
+	h := NewPolicyHandler(reporter)
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/config/policy", nil))
+		return w
+	}
+
+	// Without configuration, every setting is violated
+	w := get()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{
+		"compliant": false,
+		"violations": 2,
+		"results": [
+			{"config": "clamd", "setting": "ScanArchive", "expected": ["yes"], "actual": [], "violated": true},
+			{"config": "freshclam", "setting": "DatabaseMirror", "expected": ["mirror.internal"], "actual": [], "violated": true}
+		]
+	}`, w.Body.String())
+
+	clamd, err := clamdconf.Parse(strings.NewReader("ScanArchive true\n"))
+	assert.NoError(t, err)
+	reporter.SetConfig(clamdconf.ConfigClamd, clamd)
+	freshclam, err := clamdconf.Parse(strings.NewReader("DatabaseMirror mirror.internal\n"))
+	assert.NoError(t, err)
+	reporter.SetConfig(clamdconf.ConfigFreshclam, freshclam)
+	assert.JSONEq(t, `{
+		"compliant": true,
+		"violations": 0,
+		"results": [
+			{"config": "clamd", "setting": "ScanArchive", "expected": ["yes"], "actual": ["true"], "violated": false},
+			{"config": "freshclam", "setting": "DatabaseMirror", "expected": ["mirror.internal"], "actual": ["mirror.internal"], "violated": false}
+		]
+	}`, get().Body.String())
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/config/policy", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxProbeTargets bounds the clients kept by ProbeHandler, and so the sessions they keep open
+	maxProbeTargets = 100
+	// probeIdleTimeout is the time after which the client of a target which isn't probed anymore is closed
+	probeIdleTimeout = 10 * time.Minute
+)
+
+// errInvalidTLS hides why the TLS configuration of a target is invalid, which may tell if local files exist
+var errInvalidTLS = errors.New("invalid TLS configuration")
+
+// ProbeHandler serves the metrics of the clamd given by the target query parameter,
+// e.g. /probe?target=tcp://clamd:3310, so that a single exporter can monitor several clamd.
+// A client is kept for each target, so that its connection pool and circuit breaker last across probes.
+// Clients are closed when their target isn't probed during probeIdleTimeout, or when maxProbeTargets are
+// kept, starting with the least recently probed.
+type ProbeHandler struct {
+	configure    func(client *clamav.Client)
+	newCollector func(client clamav.Client) prometheus.Collector
+	maxTargets   int
+	idleTimeout  time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*probeClient
+}
+
+// probeClient is the client of a probed target
+type probeClient struct {
+	client   *clamav.Client
+	lastUsed time.Time
+}
+
+// NewProbeHandler creates a new ProbeHandler. configure sets up the client of a new target,
+// and newCollector creates the collector of a target.
+func NewProbeHandler(configure func(client *clamav.Client), newCollector func(client clamav.Client) prometheus.Collector) *ProbeHandler {
+	return &ProbeHandler{
+		configure:    configure,
+		newCollector: newCollector,
+		maxTargets:   maxProbeTargets,
+		idleTimeout:  probeIdleTimeout,
+		clients:      map[string]*probeClient{},
+	}
+}
+
+// evict closes the clients idle for idleTimeout, and the least recently used one when maxTargets
+// are kept, the lock must be held
+func (h *ProbeHandler) evict(now time.Time) {
+	var oldest string
+	for target, c := range h.clients {
+		if now.Sub(c.lastUsed) >= h.idleTimeout {
+			log.Debug("Closing idle client of ", target)
+			c.client.Close()
+			delete(h.clients, target)
+			continue
+		}
+		if oldest == "" || c.lastUsed.Before(h.clients[oldest].lastUsed) {
+			oldest = target
+		}
+	}
+	if len(h.clients) >= h.maxTargets {
+		log.Debug("Closing least recently used client of ", oldest)
+		h.clients[oldest].client.Close()
+		delete(h.clients, oldest)
+	}
+}
+
+// client returns the client of target, created on its first probe
+func (h *ProbeHandler) client(target clamav.Target) (*clamav.Client, int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if c, ok := h.clients[target.String()]; ok {
+		c.lastUsed = now
+		return c.client, http.StatusOK, nil
+	}
+	h.evict(now)
+	client, err := clamav.NewFromTarget(target)
+	if err != nil {
+		log.Warn("Error probing ", target, ": ", err)
+		return nil, http.StatusBadRequest, errInvalidTLS
+	}
+	h.configure(client)
+	h.clients[target.String()] = &probeClient{client: client, lastUsed: now}
+	return client, http.StatusOK, nil
+}
+
+// ServeHTTP satisfies http.Handler. The ca, cert and key parameters of tls targets are rejected,
+// as they would let any caller read local files and use the client certificates of the exporter.
+func (h *ProbeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	raw := r.URL.Query().Get("target")
+	if raw == "" {
+		http.Error(w, "missing target parameter", http.StatusBadRequest)
+		return
+	}
+	target, err := clamav.ParseTarget(raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if target.TLS.CAFile != "" || target.TLS.CertFile != "" || target.TLS.KeyFile != "" {
+		http.Error(w, "parameters ca, cert and key are not allowed on /probe", http.StatusBadRequest)
+		return
+	}
+
+	client, status, err := h.client(target)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	log.Debug("Probing ", target)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(h.newCollector(*client))
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
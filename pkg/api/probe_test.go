@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/collector"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestProbeHandler() *ProbeHandler {
+	return NewProbeHandler(func(client *clamav.Client) {}, func(client clamav.Client) prometheus.Collector {
+		probeCollector, _ := collector.New(client, clamav.NewScanReport(""))
+		return probeCollector
+	})
+}
+
+func probe(h http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/probe?target="+url.QueryEscape(target), nil))
+	return w
+}
+
+func TestProbeHandlerRejectsTLSFiles(t *testing.T) {
+	h := newTestProbeHandler()
+	for _, target := range []string{
+		"tls://clamd:3310?ca=/etc/shadow",
+		"tls://clamd:3310?cert=/etc/clamav/client.pem&key=/etc/clamav/client-key.pem",
+	} {
+		w := probe(h, target)
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+		assert.NotContains(t, w.Body.String(), "/etc/", target)
+	}
+	assert.Empty(t, h.clients)
+}
+
+func TestProbeHandler(t *testing.T) {
+	var servers []*clamavtest.Server
+	for range 3 {
+		server, err := clamavtest.NewServer("tcp", "")
+		assert.NoError(t, err)
+		defer server.Close()
+		servers = append(servers, server)
+	}
+	target := func(i int) string { return "tcp://" + servers[i].Address }
+
+	h := NewProbeHandler(func(client *clamav.Client) {
+		client.SetPool(2, time.Minute, time.Hour)
+	}, func(client clamav.Client) prometheus.Collector {
+		probeCollector, _ := collector.New(client, clamav.NewScanReport(""))
+		return probeCollector
+	})
+	h.maxTargets = 2
+
+	w := probe(h, target(0))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "\nclamav_up 1\n")
+	client := h.clients[target(0)].client
+	probe(h, target(0))
+	assert.Same(t, client, h.clients[target(0)].client, "the client of a target is kept across probes")
+
+	// The least recently probed target is closed when too many targets are kept
+	probe(h, target(1))
+	probe(h, target(0))
+	probe(h, target(2))
+	assert.Len(t, h.clients, 2)
+	assert.Contains(t, h.clients, target(0))
+	assert.NotContains(t, h.clients, target(1))
+
+	// Targets which aren't probed anymore are closed
+	h.idleTimeout = 50 * time.Millisecond
+	time.Sleep(h.idleTimeout)
+	probe(h, target(1))
+	assert.Len(t, h.clients, 1)
+	stats, _ := client.PoolStats()
+	assert.Equal(t, 1, stats.Evictions[clamav.EvictionIdle], "the sessions of closed clients are closed")
+
+	assert.Equal(t, http.StatusBadRequest, probe(h, "").Code)
+	assert.Equal(t, http.StatusBadRequest, probe(h, "ftp://clamd:3310").Code)
+}
@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/collector"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
+	log "github.com/sirupsen/logrus"
+)
+
+// Reload results recorded by the ReloadObserver
+const (
+	ReloadResultSuccess = collector.ReloadResultSuccess
+	ReloadResultTimeout = collector.ReloadResultTimeout
+	ReloadResultError   = collector.ReloadResultError
+)
+
+// ReloadObserver records the outcome of every reload handled by ReloadHandler
+type ReloadObserver interface {
+	ObserveReload(result string, duration time.Duration)
+}
+
+// ReloadHandler sends RELOAD to clamd and waits for the database version to change
+type ReloadHandler struct {
+	client clamav.Client
+	// poller polls VERSION during a reload, without circuit breaker as clamd may not answer while reloading
+	poller   clamav.Client
+	token    string
+	timeout  time.Duration
+	interval time.Duration
+	observer ReloadObserver
+	mu       sync.Mutex
+}
+
+// ReloadResponse is the JSON body returned by ReloadHandler
+type ReloadResponse struct {
+	Result          string  `json:"result"`
+	PreviousVersion string  `json:"previous_database_version,omitempty"`
+	Version         string  `json:"database_version,omitempty"`
+	Duration        float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// NewReloadHandler creates a new ReloadHandler. Requests must send token as a bearer token.
+func NewReloadHandler(client clamav.Client, token string, timeout, interval time.Duration, observer ReloadObserver) *ReloadHandler {
+	poller := client
+	poller.SetCircuitBreaker(0, 0)
+	return &ReloadHandler{
+		client:   client,
+		poller:   poller,
+		token:    token,
+		timeout:  timeout,
+		interval: interval,
+		observer: observer,
+	}
+}
+
+func (h *ReloadHandler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+// ServeHTTP satisfies http.Handler
+func (h *ReloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !h.mu.TryLock() {
+		http.Error(w, "a reload is already in progress", http.StatusConflict)
+		return
+	}
+	defer h.mu.Unlock()
+
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Now().Add(h.timeout + 5*time.Second))
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	// The same duration is recorded and returned, from the request of the previous database version
+	start := time.Now()
+	response := h.reload(ctx, start)
+	duration := time.Since(start)
+	response.Duration = duration.Seconds()
+	h.observer.ObserveReload(response.Result, duration)
+
+	code := http.StatusOK
+	switch response.Result {
+	case ReloadResultTimeout:
+		code = http.StatusGatewayTimeout
+	case ReloadResultError:
+		code = http.StatusBadGateway
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error("Error writing reload response: ", err)
+	}
+}
+
+// reload returns the outcome of the reload started at start, without its duration
+func (h *ReloadHandler) reload(ctx context.Context, start time.Time) ReloadResponse {
+	previous, err := databaseVersion(ctx, h.client)
+	if err != nil {
+		return ReloadResponse{Result: ReloadResultError, Error: err.Error()}
+	}
+
+	log.Info("Requesting database reload, current database version: ", previous)
+	reply, err := h.client.Send(commands.RELOAD)
+	if err != nil {
+		return ReloadResponse{Result: ReloadResultError, PreviousVersion: previous, Error: err.Error()}
+	}
+	if cleanReply := strings.TrimSpace(string(reply)); cleanReply != "RELOADING" {
+		return ReloadResponse{Result: ReloadResultError, PreviousVersion: previous, Error: "unexpected reply to RELOAD: " + cleanReply}
+	}
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Warn("Database version did not change after reload")
+			return ReloadResponse{Result: ReloadResultTimeout, PreviousVersion: previous, Version: previous}
+		case <-ticker.C:
+			// clamd may not answer while reloading, keep polling
+			current, err := databaseVersion(ctx, h.poller)
+			if err != nil {
+				log.Debug("Error polling database version: ", err)
+				continue
+			}
+			if current != previous {
+				log.Info("Database reloaded in ", time.Since(start), ", new database version: ", current)
+				return ReloadResponse{Result: ReloadResultSuccess, PreviousVersion: previous, Version: current}
+			}
+		}
+	}
+}
+
+// databaseVersion returns the database version of clamd reached by client
+func databaseVersion(ctx context.Context, client clamav.Client) (string, error) {
+	reply, err := client.SendContext(ctx, commands.VERSION)
+	if err != nil {
+		return "", err
+	}
+	version, ok := clamav.ParseVersion(reply)
+	if !ok {
+		return "", fmt.Errorf("unexpected reply to VERSION: %s", strings.TrimSpace(string(reply)))
+	}
+	return version.Database, nil
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const reloadedVersion = "ClamAV 1.4.1/27524/Mon Jan 20 09:40:50 2025"
+
+type reloadObservation struct {
+	result   string
+	duration time.Duration
+}
+
+type fakeReloadObserver struct {
+	mu           sync.Mutex
+	observations []reloadObservation
+}
+
+func (o *fakeReloadObserver) ObserveReload(result string, duration time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.observations = append(o.observations, reloadObservation{result: result, duration: duration})
+}
+
+func newTestReloadHandler(t *testing.T, timeout time.Duration) (*ReloadHandler, *clamavtest.Server, *fakeReloadObserver) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	observer := &fakeReloadObserver{}
+	client := clamav.New(server.Address, server.Network)
+	return NewReloadHandler(*client, "secret", timeout, 10*time.Millisecond, observer), server, observer
+}
+
+func reload(h http.Handler, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/admin/reload", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func decodeReload(t *testing.T, w *httptest.ResponseRecorder) ReloadResponse {
+	var response ReloadResponse
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	return response
+}
+
+func TestReloadHandlerUnauthorized(t *testing.T) {
+	h, server, observer := newTestReloadHandler(t, time.Second)
+	for _, token := range []string{"", "wrong"} {
+		w := reload(h, token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, token)
+		assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+	}
+	assert.Empty(t, server.Requests())
+	assert.Empty(t, observer.observations)
+}
+
+func TestReloadHandlerConflict(t *testing.T) {
+	h, server, _ := newTestReloadHandler(t, time.Second)
+	// A reload is in progress
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w := reload(h, "secret")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, server.Requests())
+}
+
+func TestReloadHandlerUnexpectedReply(t *testing.T) {
+	h, server, observer := newTestReloadHandler(t, time.Second)
+	server.SetReply("RELOAD", "COMMAND UNAVAILABLE")
+
+	w := reload(h, "secret")
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	response := decodeReload(t, w)
+	assert.Equal(t, ReloadResultError, response.Result)
+	assert.Equal(t, "unexpected reply to RELOAD: COMMAND UNAVAILABLE", response.Error)
+	assert.Equal(t, "27523", response.PreviousVersion)
+	assert.Len(t, observer.observations, 1)
+	assert.Equal(t, ReloadResultError, observer.observations[0].result)
+}
+
+func TestReloadHandlerSuccess(t *testing.T) {
+	h, server, observer := newTestReloadHandler(t, 5*time.Second)
+	// clamd answers with the previous version until the reload is done
+	go func() {
+		for !slices.Contains(server.Requests(), "RELOAD") {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(50 * time.Millisecond)
+		server.SetReply("VERSION", reloadedVersion)
+	}()
+
+	w := reload(h, "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	response := decodeReload(t, w)
+	assert.Equal(t, ReloadResultSuccess, response.Result)
+	assert.Equal(t, "27523", response.PreviousVersion)
+	assert.Equal(t, "27524", response.Version)
+
+	requests := server.Requests()
+	assert.Equal(t, []string{"VERSION", "RELOAD"}, requests[:2])
+	assert.Greater(t, len(requests), 3, "the version is polled until it changes")
+
+	assert.Len(t, observer.observations, 1)
+	assert.Equal(t, ReloadResultSuccess, observer.observations[0].result)
+	// The recorded and returned durations are the same
+	assert.Equal(t, observer.observations[0].duration.Seconds(), response.Duration)
+	assert.GreaterOrEqual(t, response.Duration, 0.05)
+}
+
+func TestReloadHandlerTimeout(t *testing.T) {
+	h, _, observer := newTestReloadHandler(t, 100*time.Millisecond)
+
+	w := reload(h, "secret")
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	response := decodeReload(t, w)
+	assert.Equal(t, ReloadResultTimeout, response.Result)
+	assert.Equal(t, "27523", response.Version)
+	assert.GreaterOrEqual(t, response.Duration, 0.1)
+
+	assert.Len(t, observer.observations, 1)
+	assert.Equal(t, ReloadResultTimeout, observer.observations[0].result)
+	assert.Equal(t, observer.observations[0].duration.Seconds(), response.Duration)
+}
+
+func TestReloadHandlerCircuitBreaker(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	client := clamav.New(server.Address, server.Network)
+	client.SetCircuitBreaker(1, time.Minute)
+	h := NewReloadHandler(*client, "secret", 5*time.Second, 10*time.Millisecond, &fakeReloadObserver{})
+
+	// clamd doesn't answer while reloading
+	go func() {
+		for !slices.Contains(server.Requests(), "RELOAD") {
+			time.Sleep(time.Millisecond)
+		}
+		server.SetDisconnect("VERSION", true)
+		time.Sleep(50 * time.Millisecond)
+		server.SetReply("VERSION", reloadedVersion)
+		server.SetDisconnect("VERSION", false)
+	}()
+
+	w := reload(h, "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, ReloadResultSuccess, decodeReload(t, w).Result)
+	assert.Equal(t, clamav.CircuitClosed, client.CircuitState(), "failed polls aren't recorded by the circuit breaker")
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	log "github.com/sirupsen/logrus"
+)
+
+// Scan results recorded by the ScanObserver
+const (
+	ScanResultClean    = "clean"
+	ScanResultInfected = "infected"
+	ScanResultError    = "error"
+)
+
+// ScanObserver records the outcome of every scan handled by ScanHandler
+type ScanObserver interface {
+	ObserveScan(result string, duration time.Duration)
+}
+
+// ScanHandler streams request bodies to clamd with INSTREAM and replies with a JSON verdict
+type ScanHandler struct {
+	client    clamav.Client
+	maxLength int64
+	chunkSize int
+	timeout   time.Duration
+	observer  ScanObserver
+	listener  clamav.Listener
+}
+
+// ScanResponse is the JSON verdict returned by ScanHandler
+type ScanResponse struct {
+	Status    string  `json:"status"`
+	Infected  bool    `json:"infected"`
+	Signature string  `json:"signature,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	Size      int64   `json:"size"`
+	Duration  float64 `json:"duration_seconds"`
+}
+
+// NewScanHandler creates a new ScanHandler. maxLength should match StreamMaxLength of clamd.conf.
+// listener is notified of detections.
+func NewScanHandler(client clamav.Client, maxLength int64, chunkSize int, timeout time.Duration, observer ScanObserver, listener clamav.Listener) (*ScanHandler, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d, it must be positive", chunkSize)
+	}
+	return &ScanHandler{
+		client:    client,
+		maxLength: maxLength,
+		chunkSize: chunkSize,
+		timeout:   timeout,
+		observer:  observer,
+		listener:  listener,
+	}, nil
+}
+
+// countingReader counts the bytes read from the request body
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// ServeHTTP satisfies http.Handler
+func (h *ScanHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.ContentLength > h.maxLength {
+		h.observer.ObserveScan(ScanResultError, 0)
+		writeScanResponse(w, http.StatusRequestEntityTooLarge, ScanResponse{Status: clamav.ScanStatusError, Error: "request body exceeds the maximum stream length", Size: r.ContentLength})
+		return
+	}
+
+	// The server timeouts are tuned for scrapes, uploads need longer
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(h.timeout)
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+
+	ctx, cancel := context.WithDeadline(r.Context(), deadline)
+	defer cancel()
+
+	body := &countingReader{r: http.MaxBytesReader(w, r.Body, h.maxLength)}
+
+	start := time.Now()
+	reply, err := h.client.Instream(ctx, body, h.chunkSize)
+	duration := time.Since(start)
+
+	if err != nil {
+		h.observer.ObserveScan(ScanResultError, duration)
+
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeScanResponse(w, http.StatusRequestEntityTooLarge, ScanResponse{Status: clamav.ScanStatusError, Error: "request body exceeds the maximum stream length", Size: body.n, Duration: duration.Seconds()})
+			return
+		}
+
+		log.Error("Error scanning stream: ", err)
+		writeScanResponse(w, http.StatusBadGateway, ScanResponse{Status: clamav.ScanStatusError, Error: err.Error(), Size: body.n, Duration: duration.Seconds()})
+		return
+	}
+
+	result := clamav.ParseScanResult(string(reply))
+	response := ScanResponse{
+		Status:    result.Status,
+		Infected:  result.Infected(),
+		Signature: result.Signature,
+		Error:     result.Message,
+		Size:      body.n,
+		Duration:  duration.Seconds(),
+	}
+
+	switch result.Status {
+	case clamav.ScanStatusOK:
+		h.observer.ObserveScan(ScanResultClean, duration)
+		writeScanResponse(w, http.StatusOK, response)
+	case clamav.ScanStatusFound:
+		log.Info("Stream scan found: ", result.Signature)
+		h.observer.ObserveScan(ScanResultInfected, duration)
+
+		// The optional name query parameter identifies the scanned file
+		path := r.URL.Query().Get("name")
+		if path == "" {
+			path = result.Path
+		}
+		h.listener.OnDetection(clamav.Detection{Source: clamav.SourceStream, Path: path, Signature: result.Signature, Time: time.Now()})
+		writeScanResponse(w, http.StatusOK, response)
+	default:
+		log.Error("Error reported by clamd: ", result.Message)
+		h.observer.ObserveScan(ScanResultError, duration)
+		if strings.Contains(result.Message, "size limit exceeded") {
+			writeScanResponse(w, http.StatusRequestEntityTooLarge, response)
+			return
+		}
+		writeScanResponse(w, http.StatusBadGateway, response)
+	}
+}
+
+func writeScanResponse(w http.ResponseWriter, code int, response ScanResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Error("Error writing scan response: ", err)
+	}
+}
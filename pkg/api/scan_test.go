@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeScanObserver struct {
+	mu      sync.Mutex
+	results []string
+}
+
+func (o *fakeScanObserver) ObserveScan(result string, duration time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.results = append(o.results, result)
+}
+
+type fakeDetectionListener struct {
+	detections []clamav.Detection
+}
+
+func (l *fakeDetectionListener) OnDetection(d clamav.Detection) {
+	l.detections = append(l.detections, d)
+}
+
+func (l *fakeDetectionListener) OnSummary(s clamav.Summary) {}
+
+func newTestScanHandler(t *testing.T) (*ScanHandler, *clamavtest.Server, *fakeScanObserver, *fakeDetectionListener) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	observer := &fakeScanObserver{}
+	listener := &fakeDetectionListener{}
+	h, err := NewScanHandler(*clamav.New(server.Address, server.Network), 128, 16, time.Second, observer, listener)
+	assert.NoError(t, err)
+	return h, server, observer, listener
+}
+
+func scan(h http.Handler, r *http.Request) (*httptest.ResponseRecorder, ScanResponse) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	var response ScanResponse
+	_ = json.NewDecoder(w.Body).Decode(&response)
+	return w, response
+}
+
+func TestNewScanHandler(t *testing.T) {
+	for _, chunkSize := range []int{0, -1} {
+		_, err := NewScanHandler(clamav.Client{}, 128, chunkSize, time.Second, &fakeScanObserver{}, &fakeDetectionListener{})
+		assert.Error(t, err)
+	}
+}
+
+func TestScanHandler(t *testing.T) {
+	h, server, observer, listener := newTestScanHandler(t)
+
+	w, response := scan(h, httptest.NewRequest(http.MethodPost, "/scan", strings.NewReader("clean")))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, ScanResponse{Status: clamav.ScanStatusOK, Size: 5, Duration: response.Duration}, response)
+
+	w, response = scan(h, httptest.NewRequest(http.MethodPost, "/scan?name=invoice.pdf", strings.NewReader(clamavtest.EicarSignature)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, response.Infected)
+	assert.Equal(t, clamav.ScanStatusFound, response.Status)
+	assert.Equal(t, "Eicar-Test-Signature", response.Signature)
+	assert.Len(t, listener.detections, 1)
+	assert.Equal(t, "invoice.pdf", listener.detections[0].Path)
+	assert.Equal(t, clamav.SourceStream, listener.detections[0].Source)
+
+	w, _ = scan(h, httptest.NewRequest(http.MethodGet, "/scan", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, http.MethodPost, w.Header().Get("Allow"))
+
+	assert.Equal(t, []string{ScanResultClean, ScanResultInfected}, observer.results)
+	assert.Equal(t, []string{"INSTREAM", "INSTREAM"}, server.Requests())
+}
+
+func TestScanHandlerTooLarge(t *testing.T) {
+	h, server, observer, _ := newTestScanHandler(t)
+	large := strings.Repeat("x", 256)
+
+	// Content-Length exceeds the maximum length: clamd isn't queried
+	w, response := scan(h, httptest.NewRequest(http.MethodPost, "/scan", strings.NewReader(large)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, int64(256), response.Size)
+	assert.Empty(t, server.Requests())
+
+	// Without Content-Length, the body is cut at the maximum length
+	r := httptest.NewRequest(http.MethodPost, "/scan", io.NopCloser(strings.NewReader(large)))
+	r.ContentLength = -1
+	w, response = scan(h, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, int64(128), response.Size)
+
+	// clamd rejects streams longer than StreamMaxLength of clamd.conf
+	server.SetReply("INSTREAM", "INSTREAM size limit exceeded. ERROR")
+	w, response = scan(h, httptest.NewRequest(http.MethodPost, "/scan", strings.NewReader("clean")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, clamav.ScanStatusError, response.Status)
+	assert.Equal(t, "INSTREAM size limit exceeded.", response.Error)
+
+	assert.Equal(t, []string{ScanResultError, ScanResultError, ScanResultError}, observer.results)
+}
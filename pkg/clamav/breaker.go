@@ -0,0 +1,110 @@
+package clamav
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// States of the circuit breaker
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+// ErrCircuitOpen is returned without connecting to clamd while the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// circuitBreaker stops connecting to a clamd after consecutive failures. Once open, it lets a
+// single trial command through after openDuration, which closes it again on success.
+type circuitBreaker struct {
+	failures     int
+	openDuration time.Duration
+
+	mu          sync.Mutex
+	state       string
+	consecutive int
+	openedAt    time.Time
+	trial       bool
+}
+
+func newCircuitBreaker(failures int, openDuration time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		failures:     failures,
+		openDuration: openDuration,
+		state:        CircuitClosed,
+	}
+}
+
+// allow returns whether a command can be sent to clamd
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.trial = true
+		return true
+	case CircuitHalfOpen:
+		// Only one trial at a time
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the result of a command
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+	if err == nil {
+		b.state = CircuitClosed
+		b.consecutive = 0
+		return
+	}
+	b.consecutive++
+	if b.state == CircuitHalfOpen || b.consecutive >= b.failures {
+		b.state = CircuitOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// reset closes the breaker
+func (b *circuitBreaker) reset() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = CircuitClosed
+	b.consecutive = 0
+	b.trial = false
+}
+
+// current returns the state of the breaker
+func (b *circuitBreaker) current() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.openDuration {
+		// The next command is a trial
+		return CircuitHalfOpen
+	}
+	return b.state
+}
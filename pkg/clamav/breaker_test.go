@@ -0,0 +1,105 @@
+package clamav
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientRetries(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	server.SetDisconnect("PING", true)
+	server.SetDisconnect("RELOAD", true)
+
+	client := New(server.Address, "tcp")
+	client.SetRetries(2, time.Millisecond)
+
+	_, err = client.Send(commands.PING)
+	assert.Error(t, err)
+	// RELOAD isn't idempotent, so it isn't retried
+	_, err = client.Send(commands.RELOAD)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"PING", "PING", "PING", "RELOAD"}, server.Requests())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	server.SetDisconnect("PING", true)
+
+	client := New(server.Address, "tcp")
+	assert.Equal(t, "", client.CircuitState())
+	client.SetCircuitBreaker(2, 50*time.Millisecond)
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+
+	for i := 0; i < 2; i++ {
+		_, err = client.Send(commands.PING)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, CircuitOpen, client.CircuitState())
+
+	// clamd isn't queried while the circuit is open
+	_, err = client.Send(commands.PING)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Len(t, server.Requests(), 2)
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, CircuitHalfOpen, client.CircuitState())
+
+	// A failed trial opens the circuit again
+	_, err = client.Send(commands.PING)
+	assert.Error(t, err)
+	assert.Equal(t, CircuitOpen, client.CircuitState())
+
+	time.Sleep(60 * time.Millisecond)
+	server.SetDisconnect("PING", false)
+	resp, err := client.Send(commands.PING)
+	assert.NoError(t, err)
+	assert.Equal(t, "PONG\n", string(resp))
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+}
+
+// slowReader returns a byte every delay, like a slow upload
+type slowReader struct {
+	delay time.Duration
+}
+
+func (r slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	p[0] = 'x'
+	return 1, nil
+}
+
+func TestInstreamCircuitBreaker(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+
+	client := New(server.Address, "tcp")
+	client.SetCircuitBreaker(1, time.Minute)
+
+	// Failures of the client don't open the circuit
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.Instream(ctx, slowReader{delay: 20 * time.Millisecond}, 1)
+	assert.Error(t, err)
+	_, err = client.Instream(context.Background(), iotest.ErrReader(errors.New("upload aborted")), 8)
+	assert.Error(t, err)
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+
+	// clamd not accepting connections does
+	server.Close()
+	_, err = client.Instream(context.Background(), strings.NewReader("clean"), 8)
+	assert.Error(t, err)
+	assert.Equal(t, CircuitOpen, client.CircuitState())
+}
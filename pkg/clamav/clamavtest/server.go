@@ -0,0 +1,289 @@
+// Package clamavtest provides a scriptable fake clamd for tests and local development.
+package clamavtest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default replies of the fake clamd
+const (
+	DefaultVersion = "ClamAV 1.4.1/27523/Sun Jan 19 09:40:50 2025"
+	DefaultStats   = "POOLS: 1\n\n" +
+		"STATE: VALID PRIMARY\n" +
+		"THREADS: live 1  idle 0 max 12 idle-timeout 30\n" +
+		"QUEUE: 0 items\n\t" +
+		"        FILDES 41.249971 fd[11]\n" +
+		"        STATS 0.000075\n" +
+		"STATS 0.000146 \n\n" +
+		"MEMSTATS: heap 3.656M mmap 0.129M used 3.236M free 0.420M releasable 0.127M pools 1 pools_used 1089.550M pools_total 1089.585M\n" +
+		"END"
+	DefaultCommands = "COMMANDS: SCAN QUIT RELOAD PING CONTSCAN VERSIONCOMMANDS VERSION END SHUTDOWN MULTISCAN FILDES STATS IDSESSION INSTREAM DETSTATSCLEAR DETSTATS ALLMATCHSCAN"
+
+	// EicarSignature is found by INSTREAM in the streamed data
+	EicarSignature = "EICAR-STANDARD-ANTIVIRUS-TEST-FILE"
+)
+
+// Server is a fake clamd listening on tcp or a unix socket
+type Server struct {
+	Network string
+	Address string
+
+	listener net.Listener
+	tempDir  string
+
+	mu         sync.Mutex
+	replies    map[string]string
+	disconnect map[string]bool
+	latency    time.Duration
+	requests   []string
+	conns      map[net.Conn]struct{}
+
+	wg sync.WaitGroup
+}
+
+// NewServer starts a fake clamd. With an empty address, it listens on a random local port
+// for tcp, or on a socket in a temporary directory for unix.
+func NewServer(network, address string) (*Server, error) {
+	return NewTLSServer(network, address, nil)
+}
+
+// NewTLSServer starts a fake clamd behind TLS, like clamd behind stunnel. Without config, it doesn't use TLS.
+func NewTLSServer(network, address string, config *tls.Config) (*Server, error) {
+	s := &Server{
+		Network: network,
+		replies: map[string]string{
+			"PING":            "PONG",
+			"VERSION":         DefaultVersion,
+			"STATS":           DefaultStats,
+			"VERSIONCOMMANDS": DefaultVersion + "| " + DefaultCommands,
+			"RELOAD":          "RELOADING",
+		},
+		disconnect: map[string]bool{},
+		conns:      map[net.Conn]struct{}{},
+	}
+
+	if address == "" {
+		switch network {
+		case "unix":
+			dir, err := os.MkdirTemp("", "clamavtest")
+			if err != nil {
+				return nil, err
+			}
+			s.tempDir = dir
+			address = filepath.Join(dir, "clamd.sock")
+		default:
+			address = "127.0.0.1:0"
+		}
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+	s.listener = listener
+	s.Address = listener.Addr().String()
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// SetReply sets the reply to a command, e.g. SetReply("STATS", "garbage") for a malformed reply
+func (s *Server) SetReply(command, reply string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies[command] = reply
+}
+
+// SetDisconnect makes the server close the connection without reply to a command.
+// With IDSESSION, sessions are closed as soon as they are opened.
+func (s *Server) SetDisconnect(command string, disconnect bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disconnect[command] = disconnect
+}
+
+// SetLatency delays every reply
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+// Requests returns the commands received so far
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Close stops the server and closes the open connections
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	if s.tempDir != "" {
+		_ = os.RemoveAll(s.tempDir)
+	}
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// readCommand reads a command and returns it without prefix, with its reply delimiter
+func readCommand(reader *bufio.Reader) (string, byte, error) {
+	prefix, err := reader.ReadByte()
+	if err != nil {
+		return "", 0, err
+	}
+
+	delimiter := byte('\n')
+	switch prefix {
+	case 'z':
+		delimiter = 0
+	case 'n':
+	default:
+		// Command without prefix
+		_ = reader.UnreadByte()
+	}
+
+	command, err := reader.ReadString(delimiter)
+	if err != nil {
+		return "", 0, err
+	}
+	return strings.TrimSuffix(command, string(delimiter)), delimiter, nil
+}
+
+func (s *Server) handle(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	command, delimiter, err := readCommand(reader)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	closeSession := s.disconnect["IDSESSION"]
+	s.mu.Unlock()
+	if command == "IDSESSION" && closeSession {
+		// Like a clamd without sessions
+		return
+	}
+
+	if command != "IDSESSION" {
+		reply, ok := s.reply(command, reader)
+		if ok {
+			_, _ = conn.Write(append([]byte(reply), delimiter))
+		}
+		return
+	}
+
+	// In a session, replies are prefixed with the id of the request until END
+	for id := 1; ; id++ {
+		command, delimiter, err = readCommand(reader)
+		if err != nil || command == "END" {
+			return
+		}
+		reply, ok := s.reply(command, reader)
+		if !ok {
+			return
+		}
+		if _, err = conn.Write(append([]byte(fmt.Sprintf("%d: %s", id, reply)), delimiter)); err != nil {
+			return
+		}
+	}
+}
+
+// reply returns the reply to a command, or false to close the connection
+func (s *Server) reply(command string, reader *bufio.Reader) (string, bool) {
+	s.mu.Lock()
+	s.requests = append(s.requests, command)
+	name, _, _ := strings.Cut(command, " ")
+	reply, known := s.replies[name]
+	disconnect := s.disconnect[name]
+	latency := s.latency
+	s.mu.Unlock()
+
+	time.Sleep(latency)
+	if disconnect {
+		return "", false
+	}
+
+	switch {
+	case name == "INSTREAM":
+		// The stream is read before the reply set for INSTREAM, e.g. a size limit error
+		verdict, ok := instream(reader)
+		if ok && known {
+			return reply, true
+		}
+		return verdict, ok
+	case known:
+		return reply, true
+	default:
+		return "UNKNOWN COMMAND", true
+	}
+}
+
+// instream reads the chunks of an INSTREAM command and looks for the EICAR signature
+func instream(reader *bufio.Reader) (string, bool) {
+	var data []byte
+	for {
+		size := make([]byte, 4)
+		if _, err := io.ReadFull(reader, size); err != nil {
+			return "", false
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			break
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return "", false
+		}
+		data = append(data, chunk...)
+	}
+
+	if bytes.Contains(data, []byte(EicarSignature)) {
+		return "stream: Eicar-Test-Signature FOUND", true
+	}
+	return "stream: OK", true
+}
@@ -15,41 +15,264 @@ limitations under the License.
 package clamav
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
 	"fmt"
-	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
-	log "github.com/sirupsen/logrus"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
+	"sync"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
+	log "github.com/sirupsen/logrus"
 )
 
-//Client corresponds to a ClamAV client
+// Client corresponds to a ClamAV client
 type Client struct {
+	endpoint *endpoint
+
+	retries int
+	backoff time.Duration
+	breaker *circuitBreaker
+	pool    *pool
+}
+
+// endpoint is where a client connects to. It is shared by the copies of the client,
+// so that SetTarget applies to all of them.
+type endpoint struct {
+	mu      sync.RWMutex
 	address string
 	network string
+	tls     *tls.Config
+	expiry  *certExpiry
+}
+
+func newEndpoint(target Target) (*endpoint, error) {
+	e := &endpoint{address: target.dialAddress(), network: target.Network()}
+	if target.Scheme == SchemeTLS {
+		e.expiry = &certExpiry{}
+		config, err := newTLSConfig(target, e.expiry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLS configuration of %s: %s", target, err)
+		}
+		e.tls = config
+	}
+	return e, nil
 }
 
-//New create a new Client for ClamAV
+// New create a new Client for ClamAV
 func New(address, network string) *Client {
 	return &Client{
-		address: address,
-		network: network,
+		endpoint: &endpoint{
+			address: address,
+			network: network,
+		},
+	}
+}
+
+// NewFromTarget creates a new Client for the ClamAV of target
+func NewFromTarget(target Target) (*Client, error) {
+	e, err := newEndpoint(target)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{endpoint: e}, nil
+}
+
+// SetTarget makes the client, and all its copies, connect to another target, e.g. when clamd.conf changed.
+// The sessions of the pool are closed, and the circuit breaker is closed.
+func (c Client) SetTarget(target Target) error {
+	e, err := newEndpoint(target)
+	if err != nil {
+		return err
+	}
+
+	c.endpoint.mu.Lock()
+	c.endpoint.address = e.address
+	c.endpoint.network = e.network
+	c.endpoint.tls = e.tls
+	c.endpoint.expiry = e.expiry
+	c.endpoint.mu.Unlock()
+
+	c.pool.reset()
+	c.breaker.reset()
+	return nil
+}
+
+// SetRetries makes the client send idempotent commands again, up to retries times, when they fail.
+// The delay between attempts starts at backoff and doubles on each retry, with up to 50% jitter.
+func (c *Client) SetRetries(retries int, backoff time.Duration) {
+	c.retries = retries
+	c.backoff = backoff
+}
+
+// SetCircuitBreaker stops connecting to clamd after failures consecutive failed commands, during
+// openDuration, after which a single command tries clamd again. 0 failures disables the breaker.
+func (c *Client) SetCircuitBreaker(failures int, openDuration time.Duration) {
+	if failures <= 0 {
+		c.breaker = nil
+		return
+	}
+	c.breaker = newCircuitBreaker(failures, openDuration)
+}
+
+// CircuitState returns the state of the circuit breaker, or an empty string when it is disabled
+func (c Client) CircuitState() string {
+	if c.breaker == nil {
+		return ""
 	}
+	return c.breaker.current()
+}
+
+// dial connects to clamd, over TLS for tls targets
+func (c Client) dial(ctx context.Context) (net.Conn, error) {
+	c.endpoint.mu.RLock()
+	address, network, config := c.endpoint.address, c.endpoint.network, c.endpoint.tls
+	c.endpoint.mu.RUnlock()
+
+	if config != nil {
+		dialer := tls.Dialer{Config: config}
+		return dialer.DialContext(ctx, network, address)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
 }
 
 // Dial connects to a tcp or unix socket based on address. Sends commands.Command.
 func (c Client) Dial(command commands.Command) []byte {
-	conn, err := net.Dial(c.network, c.address)
+	resp, err := c.Send(command)
 	if err != nil {
-		log.Errorf("error creating socket connection for command %s: %s", command, err)
+		log.Error(err)
 		return nil
 	}
+	return resp
+}
+
+// Send connects to clamd, sends commands.Command and returns the whole response.
+// Idempotent commands are retried according to SetRetries.
+func (c Client) Send(command commands.Command) ([]byte, error) {
+	return c.SendContext(context.Background(), command)
+}
+
+// SendContext is Send, with the connection closed and the retries stopped when ctx is done,
+// e.g. to interrupt a long scan. Commands sent in a pooled session are bounded by their own timeout.
+func (c Client) SendContext(ctx context.Context, command commands.Command) ([]byte, error) {
+	if !c.breaker.allow() {
+		return nil, fmt.Errorf("error sending command %s: %w", command, ErrCircuitOpen)
+	}
+
+	var resp []byte
+	var err error
+	for attempt := 0; ; attempt++ {
+		if resp, err = c.send(ctx, command); err == nil {
+			break
+		}
+		if !command.Idempotent || attempt >= c.retries || ctx.Err() != nil {
+			break
+		}
+
+		// Exponential backoff with up to 50% jitter
+		delay := c.backoff << attempt
+		delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+		log.Debugf("Retrying command %s in %s after error: %s", command, delay, err)
+		time.Sleep(delay)
+	}
+	c.breaker.record(err)
+	return resp, err
+}
+
+func (c Client) send(ctx context.Context, command commands.Command) ([]byte, error) {
+	if c.pool != nil && command.Idempotent {
+		return c.sendPooled(ctx, command)
+	}
+	return c.sendOneShot(ctx, command)
+}
+
+func (c Client) sendOneShot(ctx context.Context, command commands.Command) ([]byte, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating socket connection for command %s: %s", command, err)
+	}
 	defer conn.Close()
+	// Interrupts a pending write or read once ctx is done
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
 
-	_, _ = conn.Write([]byte(fmt.Sprintf("%s", command)))
+	if _, err = conn.Write([]byte(command.String())); err != nil {
+		return nil, fmt.Errorf("error writing command %s: %s", command, err)
+	}
 	resp, err := ioutil.ReadAll(conn)
 	if err != nil {
-		log.Errorf("error reading socket response for command %s: %s", command, err)
-		return nil
+		return nil, fmt.Errorf("error reading socket response for command %s: %s", command, err)
 	}
-	return resp
+	// clamd always replies, so the connection was closed on error
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("empty response for command %s", command)
+	}
+	return resp, nil
+}
+
+// Instream sends the content of r to clamd with the INSTREAM command, split in chunks of
+// chunkSize bytes, and returns the clamd reply. The deadline of ctx, if any, applies to the
+// whole exchange. Only a failure to connect is recorded by the circuit breaker, as a slow upload
+// or an error of the client hitting the deadline isn't a failure of clamd.
+func (c Client) Instream(ctx context.Context, r io.Reader, chunkSize int) (resp []byte, err error) {
+	// An empty chunk would end the stream, and never read r
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size %d", chunkSize)
+	}
+	if !c.breaker.allow() {
+		return nil, fmt.Errorf("error sending command %s: %w", commands.INSTREAM, ErrCircuitOpen)
+	}
+
+	conn, err := c.dial(ctx)
+	c.breaker.record(err)
+	if err != nil {
+		return nil, fmt.Errorf("error creating socket connection for command %s: %s", commands.INSTREAM, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err = conn.Write([]byte(commands.INSTREAM.String())); err != nil {
+		return nil, fmt.Errorf("error writing command %s: %s", commands.INSTREAM, err)
+	}
+
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, errRead := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err = conn.Write(buf[:4+n]); err != nil {
+				// clamd closes the connection when StreamMaxLength is exceeded,
+				// its reply explains why so try to read it.
+				if resp, errResp := ioutil.ReadAll(conn); errResp == nil && len(resp) > 0 {
+					return resp, nil
+				}
+				return nil, fmt.Errorf("error writing stream chunk: %s", err)
+			}
+		}
+		if errRead == io.EOF || errRead == io.ErrUnexpectedEOF {
+			break
+		}
+		if errRead != nil {
+			return nil, fmt.Errorf("error reading stream: %w", errRead)
+		}
+	}
+
+	// A zero length chunk terminates the stream
+	if _, err = conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return nil, fmt.Errorf("error writing end of stream: %s", err)
+	}
+
+	resp, err = ioutil.ReadAll(conn)
+	if err != nil {
+		return nil, fmt.Errorf("error reading socket response for command %s: %s", commands.INSTREAM, err)
+	}
+	return resp, nil
 }
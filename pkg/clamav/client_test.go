@@ -15,59 +15,26 @@ limitations under the License.
 package clamav
 
 import (
-	"bufio"
-	"fmt"
-	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
-	"github.com/stretchr/testify/assert"
-	"net"
+	"context"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
+	"github.com/stretchr/testify/assert"
 )
 
-var tests = []struct {
-	network, address string
-}{
-	{"tcp", "[::]:0"},
-	{"unix", "/tmp/tmp.sock"},
-}
+var networks = []string{"tcp", "unix"}
 
 func TestClient(t *testing.T) {
-	for _, test := range tests {
-		listener, _ := net.Listen(test.network, test.address)
-		defer listener.Close()
-		go func() {
-			for {
-				conn, err := listener.Accept()
-				if err != nil {
-					continue
-				}
-				req, err := bufio.NewReader(conn).ReadBytes('\n')
-				if err != nil {
-					_ = fmt.Errorf("failed to read request: %s", err)
-				}
-				switch string(req) {
-				case "PING\n":
-					if _, err = conn.Write([]byte("PONG\n")); err != nil {
-						t.Errorf("failed to write response: %s", err)
-					}
-				case "nSTATS\n":
-					write := "POOLS: 1\n\n" +
-						"STATE: VALID PRIMARY\n" +
-						"THREADS: live 1  idle 0 max 12 idle-timeout 30\n" +
-						"QUEUE: 0 items\n\t" +
-						"        FILDES 41.249971 fd[11]\n" +
-						"        STATS 0.000075\n" +
-						"STATS 0.000146 \n\n" +
-						"MEMSTATS: heap 3.656M mmap 0.129M used 3.236M free 0.420M releasable 0.127M pools 1 pools_used 1089.550M pools_total 1089.585M\n" +
-						"END"
-					if _, err = conn.Write([]byte(write)); err != nil {
-						t.Errorf("failed to write response: %s", err)
-					}
-				}
-				conn.Close()
-			}
-		}()
-		client := New(listener.Addr().String(), test.network)
+	for _, network := range networks {
+		server, err := clamavtest.NewServer(network, "")
+		assert.NoError(t, err)
+		defer server.Close()
+
+		client := New(server.Address, network)
 		assert.Equal(t, []byte{'P', 'O', 'N', 'G', '\n'}, client.Dial(commands.PING))
 
 		stats := client.Dial(commands.STATS)
@@ -80,5 +47,46 @@ func TestClient(t *testing.T) {
 		assert.Equal(t, "3.656", matches[10][1])
 		assert.Equal(t, "0.129", matches[11][1])
 		assert.Equal(t, "3.236", matches[12][1])
+
+		assert.Equal(t, []string{"PING", "STATS"}, server.Requests())
+	}
+}
+
+func TestClientDisconnect(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+
+	server.SetDisconnect("PING", true)
+	client := New(server.Address, "tcp")
+	assert.Empty(t, client.Dial(commands.PING))
+
+	_, err = New("127.0.0.1:1", "tcp").Send(commands.PING)
+	assert.Error(t, err)
+}
+
+func TestInstream(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	server.SetLatency(10 * time.Millisecond)
+
+	client := New(server.Address, "tcp")
+	resp, err := client.Instream(context.Background(), strings.NewReader("X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*"), 8)
+	assert.NoError(t, err)
+
+	result := ParseScanResult(string(resp))
+	assert.Equal(t, "stream", result.Path)
+	assert.Equal(t, ScanStatusFound, result.Status)
+	assert.Equal(t, "Eicar-Test-Signature", result.Signature)
+
+	resp, err = client.Instream(context.Background(), strings.NewReader("clean"), 8)
+	assert.NoError(t, err)
+	assert.Equal(t, ScanStatusOK, ParseScanResult(string(resp)).Status)
+
+	// An empty chunk would never read the stream
+	for _, chunkSize := range []int{0, -1} {
+		_, err = client.Instream(context.Background(), strings.NewReader("clean"), chunkSize)
+		assert.Error(t, err)
 	}
 }
@@ -0,0 +1,75 @@
+package clamav
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sources of the database build time
+const (
+	DatabaseSourceVersion   = "version"
+	DatabaseSourceCVDHeader = "cvd_header"
+	DatabaseSourceFreshclam = "freshclam_dat"
+)
+
+// cvdHeaderSize is the size of the header of cvd and cld files, e.g.
+// ClamAV-VDB:19 Jan 2025 09-40 +0000:27523:2071436:90:<md5>:<signature>:<builder>:<time>
+const cvdHeaderSize = 512
+
+// ParseVersionDate parses the date of the VERSION reply, e.g. "Sun Jan 19 09:40:50 2025".
+// clamd prints it in its local time zone, which is given by loc.
+func ParseVersionDate(date string, loc *time.Location) (time.Time, error) {
+	// The day of month is padded with a space, e.g. "Sun Jan  5 09:40:50 2025"
+	return time.ParseInLocation("Mon Jan _2 15:04:05 2006", strings.TrimSpace(date), loc)
+}
+
+// ReadCVDBuildTime reads the build time from the header of a cvd or cld database file
+func ReadCVDBuildTime(path string) (time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	header := make([]byte, cvdHeaderSize)
+	if _, err = io.ReadFull(file, header); err != nil {
+		return time.Time{}, fmt.Errorf("error reading header of %s: %s", path, err)
+	}
+
+	fields := strings.Split(string(header), ":")
+	if len(fields) < 2 || fields[0] != "ClamAV-VDB" {
+		return time.Time{}, fmt.Errorf("invalid header in %s", path)
+	}
+	buildTime, err := time.Parse("02 Jan 2006 15-04 -0700", strings.TrimSpace(fields[1]))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error parsing build time of %s: %s", path, err)
+	}
+	return buildTime, nil
+}
+
+// DatabaseBuildTime finds the build time of the daily database in dir, from the header of
+// daily.cld or daily.cvd, or else from the last update of freshclam.dat. It returns the source used.
+func DatabaseBuildTime(dir string) (time.Time, string, error) {
+	var errs []error
+	for _, name := range []string{"daily.cld", "daily.cvd"} {
+		buildTime, err := ReadCVDBuildTime(filepath.Join(dir, name))
+		if err == nil {
+			return buildTime, DatabaseSourceCVDHeader, nil
+		}
+		errs = append(errs, err)
+	}
+
+	// freshclam.dat is rewritten by every freshclam run, so this is the time of the last update check
+	info, err := os.Stat(filepath.Join(dir, "freshclam.dat"))
+	if err == nil {
+		return info.ModTime(), DatabaseSourceFreshclam, nil
+	}
+	errs = append(errs, err)
+
+	return time.Time{}, "", errors.Join(errs...)
+}
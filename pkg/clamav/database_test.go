@@ -0,0 +1,43 @@
+package clamav
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersionDate(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	assert.NoError(t, err)
+
+	date, err := ParseVersionDate("Sun Jan 19 09:40:50 2025", paris)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, time.January, 19, 8, 40, 50, 0, time.UTC), date.UTC())
+
+	date, err = ParseVersionDate("Sun Jan  5 09:40:50 2025", time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2025, time.January, 5, 9, 40, 50, 0, time.UTC), date)
+}
+
+func TestDatabaseBuildTime(t *testing.T) {
+	dir := t.TempDir()
+
+	_, _, err := DatabaseBuildTime(dir)
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "freshclam.dat"), []byte{0}, 0600))
+	_, source, err := DatabaseBuildTime(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, DatabaseSourceFreshclam, source)
+
+	header := make([]byte, cvdHeaderSize)
+	copy(header, "ClamAV-VDB:19 Jan 2025 09-40 +0000:27523:2071436:90:md5:signature:builder:1737279600")
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "daily.cld"), header, 0600))
+	buildTime, source, err := DatabaseBuildTime(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, DatabaseSourceCVDHeader, source)
+	assert.Equal(t, time.Date(2025, time.January, 19, 9, 40, 0, 0, time.UTC), buildTime.UTC())
+}
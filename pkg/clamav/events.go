@@ -0,0 +1,53 @@
+package clamav
+
+import (
+	"time"
+)
+
+// Sources of detections and scan summaries
+const (
+	SourceClamscan = "clamscan"
+	SourceSchedule = "schedule"
+	SourceStream   = "stream"
+)
+
+// Detection corresponds to a signature found in a file by clamscan or clamd
+type Detection struct {
+	Source    string    `json:"source"`
+	Path      string    `json:"path"`
+	Signature string    `json:"signature"`
+	Time      time.Time `json:"time"`
+}
+
+// Summary corresponds to the summary of a finished scan
+type Summary struct {
+	Source        string        `json:"source"`
+	InfectedFiles int           `json:"infected_files"`
+	TotalErrors   int           `json:"total_errors"`
+	Duration      time.Duration `json:"duration"`
+	StartTime     time.Time     `json:"start_time"`
+	EndTime       time.Time     `json:"end_time"`
+}
+
+// Listener is notified of detections and scan summaries
+type Listener interface {
+	OnDetection(d Detection)
+	OnSummary(s Summary)
+}
+
+// Listeners notifies every Listener it contains
+type Listeners []Listener
+
+// OnDetection satisfies Listener
+func (ls Listeners) OnDetection(d Detection) {
+	for _, l := range ls {
+		l.OnDetection(d)
+	}
+}
+
+// OnSummary satisfies Listener
+func (ls Listeners) OnSummary(s Summary) {
+	for _, l := range ls {
+		l.OnSummary(s)
+	}
+}
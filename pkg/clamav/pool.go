@@ -0,0 +1,332 @@
+package clamav
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
+	log "github.com/sirupsen/logrus"
+)
+
+// sessionTimeout bounds a command sent in a session, which unlike one-shot connections
+// isn't closed by clamd after its reply
+const sessionTimeout = 30 * time.Second
+
+// Reasons of the evictions of pooled connections
+const (
+	EvictionIdle      = "idle"
+	EvictionLifetime  = "lifetime"
+	EvictionUnhealthy = "unhealthy"
+	EvictionError     = "error"
+)
+
+// PoolStats are the statistics of the connection pool of a client
+type PoolStats struct {
+	Idle   int
+	Active int
+	// Dials counts the sessions opened
+	Dials int
+	// Reuses counts the commands sent in an already open session
+	Reuses int
+	// Evictions counts the sessions closed, by reason
+	Evictions map[string]int
+	// Fallbacks counts the commands sent with a one-shot connection, because the pool was full,
+	// or because clamd doesn't support sessions
+	Fallbacks int
+	// Unsupported shows if clamd closed a new session, so that sessions aren't used anymore
+	Unsupported bool
+}
+
+// session is an IDSESSION connection to clamd
+type session struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	created  time.Time
+	lastUsed time.Time
+	id       int
+	// generation of the pool when the session was opened
+	generation int
+}
+
+// pool keeps a bounded number of IDSESSION connections to clamd, for the idempotent commands
+type pool struct {
+	maxConns    int
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+
+	mu    sync.Mutex
+	idle  []*session
+	stats PoolStats
+	// generation changes with the target, so that sessions to the previous target are closed
+	generation int
+}
+
+func newPool(maxConns int, idleTimeout, maxLifetime time.Duration) *pool {
+	return &pool{
+		maxConns:    maxConns,
+		idleTimeout: idleTimeout,
+		maxLifetime: maxLifetime,
+		stats:       PoolStats{Evictions: map[string]int{}},
+	}
+}
+
+// evict closes a session, the lock must be held
+func (p *pool) evict(s *session, reason string) {
+	log.Debugf("Closing clamd session (%s)", reason)
+	_ = s.conn.Close()
+	p.stats.Evictions[reason]++
+}
+
+// expired returns why a session must be closed, or an empty string
+func (p *pool) expired(s *session, now time.Time) string {
+	if p.idleTimeout > 0 && now.Sub(s.lastUsed) >= p.idleTimeout {
+		return EvictionIdle
+	}
+	if p.maxLifetime > 0 && now.Sub(s.created) >= p.maxLifetime {
+		return EvictionLifetime
+	}
+	return ""
+}
+
+// healthy checks that clamd didn't close an idle session, without waiting
+func healthy(s *session) bool {
+	_ = s.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	_, err := s.reader.Peek(1)
+	_ = s.conn.SetReadDeadline(time.Time{})
+
+	// Nothing to read is expected, anything else means that clamd closed the session
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// get returns an idle session, or nil with ok true when a new session can be opened,
+// or ok false when sessions can't be used
+func (p *pool) get() (s *session, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stats.Unsupported {
+		p.stats.Fallbacks++
+		return nil, false
+	}
+
+	now := time.Now()
+	for len(p.idle) > 0 {
+		s = p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if reason := p.expired(s, now); reason != "" {
+			p.evict(s, reason)
+			continue
+		}
+		if !healthy(s) {
+			p.evict(s, EvictionUnhealthy)
+			continue
+		}
+		p.stats.Active++
+		p.stats.Reuses++
+		return s, true
+	}
+
+	if p.stats.Active >= p.maxConns {
+		p.stats.Fallbacks++
+		return nil, false
+	}
+	p.stats.Active++
+	return nil, true
+}
+
+// put returns a session to the pool after use, or closes it after an error
+func (p *pool) put(s *session, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stats.Active--
+	if s == nil {
+		return
+	}
+	if err != nil {
+		p.evict(s, EvictionError)
+		return
+	}
+	if s.generation != p.generation {
+		p.evict(s, EvictionLifetime)
+		return
+	}
+	if reason := p.expired(s, time.Now()); reason != "" {
+		p.evict(s, reason)
+		return
+	}
+	p.idle = append(p.idle, s)
+}
+
+// unsupported stops using sessions
+func (p *pool) unsupported(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.stats.Unsupported {
+		log.Warn("clamd doesn't keep sessions open, using one connection per command: ", err)
+		p.stats.Unsupported = true
+	}
+	for _, s := range p.idle {
+		p.evict(s, EvictionError)
+	}
+	p.idle = nil
+}
+
+// reset closes the idle sessions, and the active ones once used, after a change of target.
+// Sessions may be supported by the new target.
+func (p *pool) reset() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.idle {
+		p.evict(s, EvictionLifetime)
+	}
+	p.idle = nil
+	p.generation++
+	p.stats.Unsupported = false
+}
+
+// close closes the idle sessions, and the active ones once used, when the client isn't used anymore
+func (p *pool) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, s := range p.idle {
+		p.evict(s, EvictionIdle)
+	}
+	p.idle = nil
+	p.generation++
+}
+
+func (p *pool) snapshot() PoolStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Idle = len(p.idle)
+	stats.Evictions = map[string]int{}
+	for reason, n := range p.stats.Evictions {
+		stats.Evictions[reason] = n
+	}
+	return stats
+}
+
+// openSession connects to clamd and starts a session. The generation is read before dialing, so that
+// a session dialed during a reset or a close of the pool is closed when put back.
+func (c Client) openSession() (*session, error) {
+	p := c.pool
+	p.mu.Lock()
+	generation := p.generation
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), sessionTimeout)
+	defer cancel()
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error creating socket connection for command IDSESSION: %s", err)
+	}
+	if _, err = conn.Write([]byte("zIDSESSION\x00")); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error writing command IDSESSION: %s", err)
+	}
+	p.mu.Lock()
+	p.stats.Dials++
+	p.mu.Unlock()
+
+	now := time.Now()
+	return &session{conn: conn, reader: bufio.NewReader(conn), created: now, lastUsed: now, generation: generation}, nil
+}
+
+// send sends a command in the session. The reply is terminated by a NUL byte,
+// and prefixed by the id of the command in the session, e.g. "1: PONG".
+func (s *session) send(command commands.Command) ([]byte, error) {
+	s.id++
+	_ = s.conn.SetDeadline(time.Now().Add(sessionTimeout))
+	defer s.conn.SetDeadline(time.Time{})
+
+	name := command.Name
+	if command.Arg != "" {
+		name = name + " " + command.Arg
+	}
+	if _, err := s.conn.Write([]byte("z" + name + "\x00")); err != nil {
+		return nil, fmt.Errorf("error writing command %s in session: %s", command, err)
+	}
+	reply, err := s.reader.ReadString(0)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response for command %s in session: %s", command, err)
+	}
+	id, reply, found := strings.Cut(strings.TrimSuffix(reply, "\x00"), ": ")
+	if !found || id != strconv.Itoa(s.id) {
+		return nil, fmt.Errorf("unexpected response for command %s in session: %q", command, reply)
+	}
+	s.lastUsed = time.Now()
+	// Same reply as without session
+	return []byte(reply + "\n"), nil
+}
+
+// sendPooled sends an idempotent command in a pooled session, or with a one-shot connection
+// when no session is available
+func (c Client) sendPooled(ctx context.Context, command commands.Command) ([]byte, error) {
+	s, ok := c.pool.get()
+	if !ok {
+		return c.sendOneShot(ctx, command)
+	}
+
+	fresh := s == nil
+	var err error
+	if fresh {
+		if s, err = c.openSession(); err != nil {
+			c.pool.put(nil, err)
+			return nil, err
+		}
+	}
+
+	resp, err := s.send(command)
+	c.pool.put(s, err)
+	if err == nil {
+		return resp, nil
+	}
+
+	log.Debug("Sending command again without session: ", err)
+	resp, errOneShot := c.sendOneShot(ctx, command)
+	if fresh && errOneShot == nil {
+		// clamd answers, but closed a new session on its first command
+		c.pool.unsupported(err)
+	}
+	return resp, errOneShot
+}
+
+// SetPool makes the client keep up to maxConns IDSESSION connections to clamd open for PING, STATS
+// and VERSION. Sessions idle for idleTimeout, which should be lower than IdleTimeout of clamd.conf,
+// or open for maxLifetime are closed. 0 maxConns disables the pool.
+func (c *Client) SetPool(maxConns int, idleTimeout, maxLifetime time.Duration) {
+	if maxConns <= 0 {
+		c.pool = nil
+		return
+	}
+	c.pool = newPool(maxConns, idleTimeout, maxLifetime)
+}
+
+// Close closes the sessions of the pool. The client can still be used, with new sessions.
+func (c Client) Close() {
+	c.pool.close()
+}
+
+// PoolStats returns the statistics of the connection pool, false when it is disabled
+func (c Client) PoolStats() (PoolStats, bool) {
+	if c.pool == nil {
+		return PoolStats{}, false
+	}
+	return c.pool.snapshot(), true
+}
@@ -0,0 +1,124 @@
+package clamav
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	for _, network := range networks {
+		t.Run(network, func(t *testing.T) {
+			server, err := clamavtest.NewServer(network, "")
+			assert.NoError(t, err)
+			defer server.Close()
+
+			client := New(server.Address, network)
+			_, ok := client.PoolStats()
+			assert.False(t, ok)
+			client.SetPool(2, time.Minute, time.Hour)
+
+			resp, err := client.Send(commands.PING)
+			assert.NoError(t, err)
+			assert.Equal(t, "PONG\n", string(resp))
+			resp, err = client.Send(commands.STATS)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasSuffix(string(resp), "END\n"))
+			resp, err = client.Send(commands.VERSION)
+			assert.NoError(t, err)
+			assert.Equal(t, clamavtest.DefaultVersion+"\n", string(resp))
+
+			// RELOAD isn't sent in a session
+			_, err = client.Send(commands.RELOAD)
+			assert.NoError(t, err)
+
+			stats, ok := client.PoolStats()
+			assert.True(t, ok)
+			assert.Equal(t, 1, stats.Dials)
+			assert.Equal(t, 2, stats.Reuses)
+			assert.Equal(t, 1, stats.Idle)
+			assert.Equal(t, 0, stats.Active)
+			assert.Equal(t, []string{"PING", "STATS", "VERSION", "RELOAD"}, server.Requests())
+		})
+	}
+}
+
+func TestPoolBounded(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	server.SetLatency(20 * time.Millisecond)
+
+	client := New(server.Address, "tcp")
+	client.SetPool(2, time.Minute, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Send(commands.PING)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	stats, _ := client.PoolStats()
+	assert.Equal(t, 2, stats.Dials)
+	assert.Equal(t, 3, stats.Fallbacks)
+	assert.Equal(t, 2, stats.Idle)
+	assert.Equal(t, 0, stats.Active)
+}
+
+func TestPoolEviction(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+
+	client := New(server.Address, "tcp")
+	client.SetPool(1, 10*time.Millisecond, time.Hour)
+
+	_, err = client.Send(commands.PING)
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	_, err = client.Send(commands.PING)
+	assert.NoError(t, err)
+
+	stats, _ := client.PoolStats()
+	assert.Equal(t, 2, stats.Dials)
+	assert.Equal(t, 1, stats.Evictions[EvictionIdle])
+
+	// A session closed by clamd is replaced by a one-shot connection
+	server.SetDisconnect("PING", true)
+	_, err = client.Send(commands.PING)
+	assert.Error(t, err)
+	stats, _ = client.PoolStats()
+	assert.Equal(t, 1, stats.Evictions[EvictionError])
+	assert.False(t, stats.Unsupported)
+}
+
+func TestPoolUnsupported(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	server.SetDisconnect("IDSESSION", true)
+
+	client := New(server.Address, "tcp")
+	client.SetPool(2, time.Minute, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Send(commands.PING)
+		assert.NoError(t, err)
+		assert.Equal(t, "PONG\n", string(resp))
+	}
+
+	stats, _ := client.PoolStats()
+	assert.True(t, stats.Unsupported)
+	assert.Equal(t, 1, stats.Dials)
+	assert.Equal(t, 2, stats.Fallbacks)
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -18,6 +19,7 @@ type ScanReport struct {
 	countLineParsed  int
 	countLineIgnored int
 	countLineUnknown int
+	countLineError   int
 	reportStatus     bool
 	totalErrors      int
 	infectedFiles    int
@@ -25,6 +27,10 @@ type ScanReport struct {
 	scanStartTime    time.Time
 	scanEndTime      time.Time
 	errFile          error
+	hasResults       bool
+	listeners        Listeners
+	caughtUp         bool
+	mu               sync.RWMutex
 }
 
 // NewScanReport create a new ScanReport
@@ -47,24 +53,43 @@ func NewScanReport(path string) *ScanReport {
 
 // Get functions
 func (sr *ScanReport) GetFilepath() string {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return sr.filePath
 }
 func (sr *ScanReport) GetLineCount() int {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return sr.countLineRead
 }
 func (sr *ScanReport) GetParsedLineCount() int {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return sr.countLineParsed
 }
 func (sr *ScanReport) GetIgnoredLineCount() int {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return sr.countLineIgnored
 }
 func (sr *ScanReport) GetUnknownLineCount() int {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return sr.countLineUnknown
 }
+func (sr *ScanReport) GetErrorLineCount() int {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+	return sr.countLineError
+}
 func (sr *ScanReport) GetReportStatus() bool {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return sr.reportStatus
 }
 func (sr *ScanReport) GetIntReportStatus() int {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	if sr.reportStatus {
 		return 1
 	} else {
@@ -72,57 +97,105 @@ func (sr *ScanReport) GetIntReportStatus() int {
 	}
 }
 func (sr *ScanReport) GetTotalErrors() int {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return sr.totalErrors
 }
 func (sr *ScanReport) GetInfectedFiles() int {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return sr.infectedFiles
 }
 func (sr *ScanReport) GetScanDuration() time.Duration {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return sr.scanDuration
 }
 func (sr *ScanReport) GetScanStartTime() time.Time {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return sr.scanStartTime
 }
 func (sr *ScanReport) GetScanEndTime() time.Time {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return sr.scanEndTime
 }
 func (sr *ScanReport) GetErrFile() error {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
 	return sr.errFile
 }
+func (sr *ScanReport) HasResults() bool {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+	return sr.hasResults
+}
 
 // Set functions
 func (sr *ScanReport) setReportStatus(b bool) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
 	sr.reportStatus = b
 }
 func (sr *ScanReport) setTotalErrors(i int) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
 	sr.totalErrors = i
 }
 func (sr *ScanReport) setInfectedFiles(i int) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
 	sr.infectedFiles = i
 }
 func (sr *ScanReport) setScanDuration(d time.Duration) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
 	sr.scanDuration = d
 }
 func (sr *ScanReport) setScanStartTime(t time.Time) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
 	sr.scanStartTime = t
 }
 func (sr *ScanReport) setScanEndTime(t time.Time) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
 	sr.scanEndTime = t
 }
 
+// AddListener registers a Listener notified of new detections and scan summaries.
+// Lines already in the report file when the exporter starts don't trigger notifications.
+func (sr *ScanReport) AddListener(l Listener) {
+	sr.listeners = append(sr.listeners, l)
+}
+
 // Increase function for count variables
 func (sr *ScanReport) increaseLineCount(i int) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
 	sr.countLineRead = sr.countLineRead + i
 }
 func (sr *ScanReport) increaseParsedLineCount(i int) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
 	sr.countLineParsed = sr.countLineParsed + i
 }
 func (sr *ScanReport) increaseIgnoredLineCount(i int) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
 	sr.countLineIgnored = sr.countLineIgnored + i
 }
 func (sr *ScanReport) increaseUnknownLineCount(i int) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
 	sr.countLineUnknown = sr.countLineUnknown + i
 }
+func (sr *ScanReport) increaseErrorLineCount(i int) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.countLineError = sr.countLineError + i
+}
 
 func (sr *ScanReport) Tail() {
 	log.Debug("Begin to read file: " + sr.filePath)
@@ -130,7 +203,9 @@ func (sr *ScanReport) Tail() {
 	file, err := os.Open(sr.filePath)
 	if err != nil {
 		log.Error("Error reading file: ", err)
+		sr.mu.Lock()
 		sr.errFile = err
+		sr.mu.Unlock()
 		return
 	}
 	defer file.Close()
@@ -140,6 +215,8 @@ func (sr *ScanReport) Tail() {
 		line, err := reader.ReadString('\n')
 		if err != nil {
 			if err == io.EOF {
+				// Everything after this point has been written since the exporter started
+				sr.caughtUp = true
 				// without this sleep you would hogg the CPU
 				time.Sleep(500 * time.Millisecond)
 				// truncated ?
@@ -160,7 +237,7 @@ func (sr *ScanReport) Tail() {
 		}
 		log.Debug("New line read: " + cleanString(line))
 		// Parse line
-		sr.parseLine(cleanString(line))
+		sr.safeParseLine(cleanString(line))
 
 		sr.increaseLineCount(1)
 		// cl := *sr.countLineRead + 1
@@ -169,6 +246,69 @@ func (sr *ScanReport) Tail() {
 
 }
 
+// Read parses the whole report file once, e.g. for a clamscan run which is finished
+func (sr *ScanReport) Read() error {
+	log.Debug("Read file: " + sr.filePath)
+
+	file, err := os.Open(sr.filePath)
+	if err != nil {
+		sr.mu.Lock()
+		sr.errFile = err
+		sr.mu.Unlock()
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		sr.safeParseLine(cleanString(scanner.Text()))
+		sr.increaseLineCount(1)
+	}
+	return scanner.Err()
+}
+
+// RecordScan updates the report with the per-file results of a scan run directly against clamd
+func (sr *ScanReport) RecordScan(results []ScanResult, start, end time.Time) {
+	infected := map[string]bool{}
+	errors := 0
+	for _, result := range results {
+		switch result.Status {
+		case ScanStatusFound:
+			log.Info("Scan found ", result.Signature, " in ", result.Path)
+			infected[result.Path] = true
+		case ScanStatusError:
+			log.Error("Scan error on ", result.Path, ": ", result.Message)
+			errors++
+		}
+	}
+
+	sr.mu.Lock()
+	sr.reportStatus = len(infected) == 0 && errors == 0
+	sr.infectedFiles = len(infected)
+	sr.totalErrors = errors
+	sr.scanDuration = end.Sub(start)
+	sr.scanStartTime = start
+	sr.scanEndTime = end
+	sr.countLineRead = sr.countLineRead + len(results)
+	sr.countLineParsed = sr.countLineParsed + len(results)
+	sr.hasResults = true
+	sr.mu.Unlock()
+
+	for _, result := range results {
+		if result.Infected() {
+			sr.listeners.OnDetection(Detection{Source: SourceSchedule, Path: result.Path, Signature: result.Signature, Time: end})
+		}
+	}
+	sr.listeners.OnSummary(Summary{
+		Source:        SourceSchedule,
+		InfectedFiles: len(infected),
+		TotalErrors:   errors,
+		Duration:      end.Sub(start),
+		StartTime:     start,
+		EndTime:       end,
+	})
+}
+
 func isTruncated(file *os.File) (bool, error) {
 	// current read position in a file
 	currentPos, err := file.Seek(0, io.SeekCurrent)
@@ -187,6 +327,18 @@ func cleanString(s string) string {
 	return strings.TrimSpace(strings.TrimSuffix(s, "\n"))
 }
 
+// safeParseLine parses a line, counting a panic of the parser as an error line
+// instead of stopping to read the report
+func (sr *ScanReport) safeParseLine(l string) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Error parsing line %q: %v", l, r)
+			sr.increaseErrorLineCount(1)
+		}
+	}()
+	sr.parseLine(l)
+}
+
 func (sr *ScanReport) parseLine(l string) {
 	// List of ignoredLines
 	if l == "--------------------------------------" || l == "----------- SCAN SUMMARY -----------" || l == "" || strings.Contains(l, "ERROR: Could not connect to clamd") {
@@ -258,6 +410,27 @@ func (sr *ScanReport) parseLine(l string) {
 		}
 		sr.setScanEndTime(endDate)
 		sr.increaseParsedLineCount(1)
+
+		// End Date is the last line of the summary
+		if sr.caughtUp {
+			sr.listeners.OnSummary(Summary{
+				Source:        SourceClamscan,
+				InfectedFiles: sr.GetInfectedFiles(),
+				TotalErrors:   sr.GetTotalErrors(),
+				Duration:      sr.GetScanDuration(),
+				StartTime:     sr.GetScanStartTime(),
+				EndTime:       endDate,
+			})
+		}
+		return
+	}
+	if strings.HasSuffix(l, " "+ScanStatusFound) {
+		result := ParseScanResult(l)
+		log.Info("Report found ", result.Signature, " in ", result.Path)
+		if sr.caughtUp {
+			sr.listeners.OnDetection(Detection{Source: SourceClamscan, Path: result.Path, Signature: result.Signature, Time: time.Now()})
+		}
+		sr.increaseParsedLineCount(1)
 		return
 	}
 
@@ -0,0 +1,82 @@
+package clamav
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func FuzzParseLine(f *testing.F) {
+	for _, line := range []string{
+		"/host-fs: OK",
+		"/host-fs/tmp/eicar.com: Win.Test.EICAR_HDB-1 FOUND",
+		"----------- SCAN SUMMARY -----------",
+		"Infected files: 2",
+		"Total errors: 0",
+		"Time: 3609.617 sec (60 m 9 s)",
+		"Start Date: 2025:03:27 16:14:48",
+		"End Date:   2025:03:27 17:14:58",
+		"Known viruses: 8697312",
+	} {
+		f.Add(line)
+	}
+
+	out := log.StandardLogger().Out
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(out) })
+	f.Fuzz(func(t *testing.T, line string) {
+		sr := NewScanReport("")
+		sr.safeParseLine(cleanString(line))
+
+		// Every line is counted once, either parsed, ignored, unknown or in error
+		count := sr.GetParsedLineCount() + sr.GetIgnoredLineCount() + sr.GetUnknownLineCount() + sr.GetErrorLineCount()
+		assert.Equal(t, 1, count)
+	})
+}
+
+type recordingListener struct {
+	detections []Detection
+	summaries  []Summary
+}
+
+func (l *recordingListener) OnDetection(d Detection) { l.detections = append(l.detections, d) }
+func (l *recordingListener) OnSummary(s Summary)     { l.summaries = append(l.summaries, s) }
+
+func TestRecordScan(t *testing.T) {
+	sr := NewScanReport("")
+	listener := &recordingListener{}
+	sr.AddListener(listener)
+	start := time.Date(2025, 3, 27, 16, 14, 48, 0, time.UTC)
+	end := start.Add(time.Minute)
+
+	sr.RecordScan([]ScanResult{
+		{Path: "/data/clean.txt", Status: ScanStatusOK},
+		{Path: "/data/eicar.zip", Status: ScanStatusFound, Signature: "Win.Test.EICAR_HDB-1"},
+		// ALLMATCHSCAN reports every signature found in a file
+		{Path: "/data/eicar.zip", Status: ScanStatusFound, Signature: "Eicar-Signature"},
+		{Path: "/data/secret", Status: ScanStatusError, Message: "Can't open file or directory"},
+	}, start, end)
+
+	assert.True(t, sr.HasResults())
+	assert.False(t, sr.GetReportStatus())
+	assert.Equal(t, 1, sr.GetInfectedFiles())
+	assert.Equal(t, 1, sr.GetTotalErrors())
+	assert.Equal(t, time.Minute, sr.GetScanDuration())
+	assert.Equal(t, start, sr.GetScanStartTime())
+	assert.Equal(t, end, sr.GetScanEndTime())
+	assert.Equal(t, 4, sr.GetParsedLineCount())
+
+	assert.Len(t, listener.detections, 2)
+	assert.Equal(t, Detection{Source: SourceSchedule, Path: "/data/eicar.zip", Signature: "Win.Test.EICAR_HDB-1", Time: end}, listener.detections[0])
+	assert.Equal(t, []Summary{{Source: SourceSchedule, InfectedFiles: 1, TotalErrors: 1, Duration: time.Minute, StartTime: start, EndTime: end}}, listener.summaries)
+
+	// A clean scan replaces the previous results
+	sr.RecordScan([]ScanResult{{Path: "/data/clean.txt", Status: ScanStatusOK}}, end, end.Add(time.Second))
+	assert.True(t, sr.GetReportStatus())
+	assert.Equal(t, 0, sr.GetInfectedFiles())
+	assert.Equal(t, 0, sr.GetTotalErrors())
+	assert.Len(t, listener.detections, 2)
+}
@@ -0,0 +1,59 @@
+package clamav
+
+import (
+	"strings"
+)
+
+// Scan statuses reported by clamd
+const (
+	ScanStatusOK    = "OK"
+	ScanStatusFound = "FOUND"
+	ScanStatusError = "ERROR"
+)
+
+// ScanResult corresponds to one line of a clamd scan reply, e.g. "stream: Eicar-Signature FOUND"
+type ScanResult struct {
+	Path      string
+	Status    string
+	Signature string
+	Message   string
+}
+
+// Infected returns true when clamd found a signature
+func (r ScanResult) Infected() bool {
+	return r.Status == ScanStatusFound
+}
+
+// ParseScanResult parses a single clamd scan reply line
+func ParseScanResult(line string) ScanResult {
+	line = strings.TrimRight(line, "\x00\r\n ")
+
+	// The path may itself contain ": " so split on the last occurrence
+	path, verdict := "", line
+	if i := strings.LastIndex(line, ": "); i >= 0 {
+		path, verdict = line[:i], line[i+2:]
+	}
+
+	switch {
+	case verdict == ScanStatusOK:
+		return ScanResult{Path: path, Status: ScanStatusOK}
+	case strings.HasSuffix(verdict, " "+ScanStatusFound):
+		return ScanResult{Path: path, Status: ScanStatusFound, Signature: strings.TrimSuffix(verdict, " "+ScanStatusFound)}
+	case strings.HasSuffix(verdict, " "+ScanStatusError):
+		return ScanResult{Path: path, Status: ScanStatusError, Message: strings.TrimSuffix(verdict, " "+ScanStatusError)}
+	default:
+		return ScanResult{Path: path, Status: ScanStatusError, Message: verdict}
+	}
+}
+
+// ParseScanResults parses a multi-line clamd scan reply, skipping empty lines
+func ParseScanResults(reply []byte) []ScanResult {
+	var results []ScanResult
+	for _, line := range strings.FieldsFunc(string(reply), func(r rune) bool { return r == '\n' || r == '\x00' }) {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		results = append(results, ParseScanResult(line))
+	}
+	return results
+}
@@ -0,0 +1,26 @@
+package clamav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScanResults(t *testing.T) {
+	reply := "/data/clean.txt: OK\n" +
+		"/data/eicar.com: Win.Test.EICAR_HDB-1 FOUND\n" +
+		"/data/dir: with: colons.txt: OK\n" +
+		"\n" +
+		"/data/secret: Can't open file or directory ERROR\n" +
+		"/data/denied: lstat() failed: Permission denied. ERROR\x00"
+
+	assert.Equal(t, []ScanResult{
+		{Path: "/data/clean.txt", Status: ScanStatusOK},
+		{Path: "/data/eicar.com", Status: ScanStatusFound, Signature: "Win.Test.EICAR_HDB-1"},
+		{Path: "/data/dir: with: colons.txt", Status: ScanStatusOK},
+		{Path: "/data/secret", Status: ScanStatusError, Message: "Can't open file or directory"},
+		{Path: "/data/denied: lstat() failed", Status: ScanStatusError, Message: "Permission denied."},
+	}, ParseScanResults([]byte(reply)))
+
+	assert.Empty(t, ParseScanResults([]byte("\n\x00")))
+}
@@ -0,0 +1,114 @@
+package clamav
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Schemes of the target URLs
+const (
+	SchemeTCP          = "tcp"
+	SchemeUnix         = "unix"
+	SchemeUnixAbstract = "unix-abstract"
+	SchemeTLS          = "tls"
+)
+
+// DefaultPort is the port of clamd when a tcp or tls target has none
+const DefaultPort = "3310"
+
+// Target is the address of clamd, written as a URL, e.g. tcp://[::1]:3310, unix:///run/clamav/clamd.ctl,
+// unix-abstract://clamd or tls://clamd.internal:3310
+type Target struct {
+	Scheme string
+	// Address is host:port for tcp and tls, or the socket path, or the name of an abstract socket
+	Address string
+	// TLS is the configuration of a tls target
+	TLS TLSConfig
+}
+
+// ParseTarget parses and validates a target URL
+func ParseTarget(raw string) (Target, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Target{}, fmt.Errorf("invalid target %q: %s", raw, err)
+	}
+	if u.User != nil || u.Fragment != "" {
+		return Target{}, fmt.Errorf("invalid target %q: user and fragment are not supported", raw)
+	}
+
+	target := Target{Scheme: strings.ToLower(u.Scheme)}
+	switch target.Scheme {
+	case SchemeTCP, SchemeTLS:
+		if u.Path != "" {
+			return Target{}, fmt.Errorf("invalid target %q: unexpected path %s", raw, u.Path)
+		}
+		host, port := u.Hostname(), u.Port()
+		if host == "" {
+			return Target{}, fmt.Errorf("invalid target %q: missing host", raw)
+		}
+		if port == "" {
+			port = DefaultPort
+		} else if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return Target{}, fmt.Errorf("invalid target %q: invalid port %s", raw, port)
+		}
+		target.Address = net.JoinHostPort(host, port)
+		if target.Scheme == SchemeTLS {
+			if target.TLS, err = parseTLSConfig(u.Query()); err != nil {
+				return Target{}, fmt.Errorf("invalid target %q: %s", raw, err)
+			}
+		}
+	case SchemeUnix:
+		// unix:///run/clamav/clamd.ctl is an absolute path, unix://clamd.ctl a relative one
+		target.Address = u.Host + u.Path
+	case SchemeUnixAbstract:
+		target.Address = strings.TrimPrefix(u.Host+u.Path, "/")
+	case "":
+		return Target{}, fmt.Errorf("invalid target %q: missing scheme (options: tcp, unix, unix-abstract, tls)", raw)
+	default:
+		return Target{}, fmt.Errorf("invalid target %q: unsupported scheme %s (options: tcp, unix, unix-abstract, tls)", raw, u.Scheme)
+	}
+
+	if target.Address == "" {
+		return Target{}, fmt.Errorf("invalid target %q: missing socket", raw)
+	}
+	if target.Scheme != SchemeTLS && u.RawQuery != "" {
+		return Target{}, fmt.Errorf("invalid target %q: query is only supported by tls targets", raw)
+	}
+	return target, nil
+}
+
+// Network returns the network to dial the target
+func (t Target) Network() string {
+	switch t.Scheme {
+	case SchemeUnix, SchemeUnixAbstract:
+		return "unix"
+	default:
+		return "tcp"
+	}
+}
+
+// dialAddress returns the address to dial the target
+func (t Target) dialAddress() string {
+	if t.Scheme == SchemeUnixAbstract {
+		// Go dials an abstract socket when the name starts with @
+		return "@" + t.Address
+	}
+	return t.Address
+}
+
+// String returns the URL of the target
+func (t Target) String() string {
+	if query := t.TLS.query(); len(query) > 0 {
+		return t.Endpoint() + "?" + query.Encode()
+	}
+	return t.Endpoint()
+}
+
+// Endpoint returns the URL of the target without its TLS configuration, which may contain file paths,
+// e.g. for labels and attributes
+func (t Target) Endpoint() string {
+	return t.Scheme + "://" + t.Address
+}
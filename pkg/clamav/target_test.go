@@ -0,0 +1,113 @@
+package clamav
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		raw     string
+		target  Target
+		network string
+		err     bool
+	}{
+		{raw: "tcp://localhost:3310", target: Target{Scheme: SchemeTCP, Address: "localhost:3310"}, network: "tcp"},
+		{raw: "tcp://[::1]:3310", target: Target{Scheme: SchemeTCP, Address: "[::1]:3310"}, network: "tcp"},
+		{raw: "tcp://[::1]", target: Target{Scheme: SchemeTCP, Address: "[::1]:3310"}, network: "tcp"},
+		{raw: "TCP://clamd", target: Target{Scheme: SchemeTCP, Address: "clamd:3310"}, network: "tcp"},
+		{raw: "tls://clamd.internal:3310", target: Target{Scheme: SchemeTLS, Address: "clamd.internal:3310"}, network: "tcp"},
+		{raw: "unix:///run/clamav/clamd.ctl", target: Target{Scheme: SchemeUnix, Address: "/run/clamav/clamd.ctl"}, network: "unix"},
+		{raw: "unix://clamd.ctl", target: Target{Scheme: SchemeUnix, Address: "clamd.ctl"}, network: "unix"},
+		{raw: "unix-abstract://clamd", target: Target{Scheme: SchemeUnixAbstract, Address: "clamd"}, network: "unix"},
+		{
+			raw:     "tls://clamd:3310?ca=/etc/ca.pem&cert=/etc/client.pem&key=/etc/client-key.pem&server_name=clamd.internal&min_version=1.3",
+			target:  Target{Scheme: SchemeTLS, Address: "clamd:3310", TLS: TLSConfig{CAFile: "/etc/ca.pem", CertFile: "/etc/client.pem", KeyFile: "/etc/client-key.pem", ServerName: "clamd.internal", MinVersion: "1.3"}},
+			network: "tcp",
+		},
+		{raw: "tls://clamd:3310?cert=/etc/client.pem", err: true},
+		{raw: "tls://clamd:3310?min_version=1.1", err: true},
+		{raw: "tls://clamd:3310?insecure=true", err: true},
+		{raw: "tls://clamd:3310?ca=/etc/a.pem&ca=/etc/b.pem", err: true},
+		{raw: "tcp://clamd:3310?ca=/etc/ca.pem", err: true},
+		{raw: "localhost:3310", err: true},
+		{raw: "clamd", err: true},
+		{raw: "udp://clamd:3310", err: true},
+		{raw: "tcp://clamd:0", err: true},
+		{raw: "tcp://clamd:http", err: true},
+		{raw: "tcp://:3310", err: true},
+		{raw: "tcp://clamd:3310/path", err: true},
+		{raw: "tcp://user@clamd:3310", err: true},
+		{raw: "unix://", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.raw, func(t *testing.T) {
+			target, err := ParseTarget(test.raw)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.target, target)
+			assert.Equal(t, test.network, target.Network())
+
+			// The URL of a target parses to the same target
+			again, err := ParseTarget(target.String())
+			assert.NoError(t, err)
+			assert.Equal(t, target, again)
+
+			// The endpoint has no TLS parameter
+			assert.NotContains(t, target.Endpoint(), "?")
+			endpoint, err := ParseTarget(target.Endpoint())
+			assert.NoError(t, err)
+			assert.Equal(t, Target{Scheme: target.Scheme, Address: target.Address}, endpoint)
+		})
+	}
+}
+
+func TestNewFromTarget(t *testing.T) {
+	abstract := fmt.Sprintf("clamavtest-%d", os.Getpid())
+	server, err := clamavtest.NewServer("unix", "@"+abstract)
+	assert.NoError(t, err)
+	defer server.Close()
+
+	client, err := NewFromTarget(Target{Scheme: SchemeUnixAbstract, Address: abstract})
+	assert.NoError(t, err)
+	resp, err := client.Send(commands.PING)
+	assert.NoError(t, err)
+	assert.Equal(t, "PONG\n", string(resp))
+}
+
+func TestSetTarget(t *testing.T) {
+	first, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer first.Close()
+	second, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer second.Close()
+	second.SetReply("VERSION", "ClamAV 1.4.1/27400/Mon Sep 30 08:00:00 2024")
+
+	client, err := NewFromTarget(Target{Scheme: SchemeTCP, Address: first.Address})
+	assert.NoError(t, err)
+	client.SetPool(1, time.Minute, time.Hour)
+	// Copies of the client, e.g. in collectors, follow the new target
+	copied := *client
+
+	_, err = copied.Send(commands.VERSION)
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.SetTarget(Target{Scheme: SchemeTCP, Address: second.Address}))
+	resp, err := copied.Send(commands.VERSION)
+	assert.NoError(t, err)
+	assert.Equal(t, "ClamAV 1.4.1/27400/Mon Sep 30 08:00:00 2024\n", string(resp))
+
+	stats, _ := client.PoolStats()
+	assert.Equal(t, 1, stats.Evictions[EvictionLifetime], "the session to the previous target is closed")
+}
@@ -0,0 +1,171 @@
+package clamav
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSConfig is the TLS configuration of a tls target, given in the query of its URL, e.g.
+// tls://clamd:3310?ca=/etc/clamav/ca.pem&cert=/etc/clamav/client.pem&key=/etc/clamav/client-key.pem
+type TLSConfig struct {
+	// CAFile is the CA bundle verifying the server certificate, the system roots when empty
+	CAFile string
+	// CertFile and KeyFile are the client certificate and key for mTLS
+	CertFile string
+	KeyFile  string
+	// ServerName is the name sent with SNI and verified in the server certificate, the host of the target when empty
+	ServerName string
+	// MinVersion is the minimum TLS version, 1.2 when empty. (options: 1.2, 1.3)
+	MinVersion string
+}
+
+// Query parameters of the TLSConfig
+const (
+	tlsParamCA         = "ca"
+	tlsParamCert       = "cert"
+	tlsParamKey        = "key"
+	tlsParamServerName = "server_name"
+	tlsParamMinVersion = "min_version"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSConfig reads and validates the TLSConfig from the query of a target URL
+func parseTLSConfig(query url.Values) (TLSConfig, error) {
+	for param, values := range query {
+		switch param {
+		case tlsParamCA, tlsParamCert, tlsParamKey, tlsParamServerName, tlsParamMinVersion:
+			if len(values) > 1 {
+				return TLSConfig{}, fmt.Errorf("parameter %s is repeated", param)
+			}
+		default:
+			return TLSConfig{}, fmt.Errorf("unknown parameter %s (options: ca, cert, key, server_name, min_version)", param)
+		}
+	}
+
+	config := TLSConfig{
+		CAFile:     query.Get(tlsParamCA),
+		CertFile:   query.Get(tlsParamCert),
+		KeyFile:    query.Get(tlsParamKey),
+		ServerName: query.Get(tlsParamServerName),
+		MinVersion: query.Get(tlsParamMinVersion),
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return TLSConfig{}, errors.New("parameters cert and key must be given together")
+	}
+	if _, ok := tlsVersions[config.MinVersion]; config.MinVersion != "" && !ok {
+		return TLSConfig{}, fmt.Errorf("unsupported min_version %s (options: 1.2, 1.3)", config.MinVersion)
+	}
+	return config, nil
+}
+
+// query returns the TLSConfig as the query of a target URL
+func (c TLSConfig) query() url.Values {
+	query := url.Values{}
+	for param, value := range map[string]string{
+		tlsParamCA:         c.CAFile,
+		tlsParamCert:       c.CertFile,
+		tlsParamKey:        c.KeyFile,
+		tlsParamServerName: c.ServerName,
+		tlsParamMinVersion: c.MinVersion,
+	} {
+		if value != "" {
+			query.Set(param, value)
+		}
+	}
+	return query
+}
+
+// certExpiry holds the expiry of the certificates seen by a client
+type certExpiry struct {
+	mu     sync.Mutex
+	client time.Time
+	server time.Time
+}
+
+// newTLSConfig creates the tls.Config of a target. The client certificate is read on every handshake,
+// so that renewed certificates are used without restart.
+func newTLSConfig(target Target, expiry *certExpiry) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: target.TLS.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(target.Address)
+	}
+	if version, ok := tlsVersions[target.TLS.MinVersion]; ok {
+		config.MinVersion = version
+	}
+
+	if target.TLS.CAFile != "" {
+		ca, err := os.ReadFile(target.TLS.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %s", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %s", target.TLS.CAFile)
+		}
+	}
+
+	if target.TLS.CertFile != "" {
+		// Fail early on a missing or invalid client certificate
+		if _, err := loadClientCertificate(target.TLS, expiry); err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return loadClientCertificate(target.TLS, expiry)
+		}
+	}
+
+	config.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) > 0 {
+			expiry.mu.Lock()
+			expiry.server = state.PeerCertificates[0].NotAfter
+			expiry.mu.Unlock()
+		}
+		return nil
+	}
+	return config, nil
+}
+
+func loadClientCertificate(config TLSConfig, expiry *certExpiry) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading client certificate: %s", err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("error parsing client certificate: %s", err)
+		}
+	}
+	expiry.mu.Lock()
+	expiry.client = cert.Leaf.NotAfter
+	expiry.mu.Unlock()
+	return &cert, nil
+}
+
+// CertExpiry returns the expiry of the client certificate, and of the server certificate seen during the
+// last handshake. They are zero without TLS, without client certificate, or before the first handshake.
+func (c Client) CertExpiry() (client, server time.Time) {
+	c.endpoint.mu.RLock()
+	expiry := c.endpoint.expiry
+	c.endpoint.mu.RUnlock()
+
+	if expiry == nil {
+		return time.Time{}, time.Time{}
+	}
+	expiry.mu.Lock()
+	defer expiry.mu.Unlock()
+	return expiry.client, expiry.server
+}
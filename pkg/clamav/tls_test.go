@@ -0,0 +1,131 @@
+package clamav
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCert is a certificate with its key, signed by parent or self-signed without parent
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// write writes the certificate and its key in dir, and returns their paths
+func (c *testCert) write(t *testing.T, dir, name string) (string, string) {
+	certFile := filepath.Join(dir, name+".pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600))
+
+	key, err := x509.MarshalECPrivateKey(c.key)
+	assert.NoError(t, err)
+	keyFile := filepath.Join(dir, name+"-key.pem")
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600))
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestTLSClient(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "clamavtest CA"},
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	serverCert := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "clamd.test"},
+		DNSNames:    []string{"clamd.test"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		NotAfter:    time.Now().Add(12 * time.Hour).Truncate(time.Second),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca)
+	clientCert := newTestCert(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "exporter"},
+		NotAfter:    time.Now().Add(6 * time.Hour).Truncate(time.Second),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca)
+
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := clientCert.write(t, dir, "client")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	server, err := clamavtest.NewTLSServer("tcp", "", &tls.Config{
+		Certificates: []tls.Certificate{serverCert.tlsCertificate()},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	assert.NoError(t, err)
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		config TLSConfig
+		err    bool
+	}{
+		{name: "mtls", config: TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}},
+		{name: "sni", config: TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "clamd.test", MinVersion: "1.3"}},
+		{name: "without client certificate", config: TLSConfig{CAFile: caFile}, err: true},
+		{name: "unknown CA", config: TLSConfig{CertFile: certFile, KeyFile: keyFile}, err: true},
+		{name: "wrong server name", config: TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, ServerName: "other.test"}, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, err := NewFromTarget(Target{Scheme: SchemeTLS, Address: server.Address, TLS: test.config})
+			assert.NoError(t, err)
+
+			resp, err := client.Send(commands.PING)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "PONG\n", string(resp))
+
+			clientExpiry, serverExpiry := client.CertExpiry()
+			assert.True(t, clientCert.cert.NotAfter.Equal(clientExpiry))
+			assert.True(t, serverCert.cert.NotAfter.Equal(serverExpiry))
+		})
+	}
+
+	_, err = NewFromTarget(Target{Scheme: SchemeTLS, Address: server.Address, TLS: TLSConfig{CAFile: filepath.Join(dir, "missing.pem")}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,27 @@
+package clamav
+
+import (
+	"regexp"
+)
+
+// The return of VERSION should be something like: ClamAV 1.4.1/27523/Sun Jan 19 09:40:50 2025
+var versionRegex = regexp.MustCompile(`ClamAV\s([0-9.]*)/(\d+)(?:/(.+))?`)
+
+// Version corresponds to the reply of the VERSION command
+type Version struct {
+	ClamAV   string
+	Database string
+	Date     string
+}
+
+// ParseVersion parses the reply of the VERSION command
+func ParseVersion(reply []byte) (Version, bool) {
+	// The match will be a list of four elements:
+	// [0]: ClamAV, [1]: 1.4.1, [2]: 27523, [3]: Sun Jan 19 09:40:50 2025 (empty without date)
+	matches := versionRegex.FindStringSubmatch(string(reply))
+	if len(matches) < 4 {
+		return Version{}, false
+	}
+
+	return Version{ClamAV: matches[1], Database: matches[2], Date: cleanString(matches[3])}, true
+}
@@ -0,0 +1,20 @@
+package clamav
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	version, ok := ParseVersion([]byte("ClamAV 1.4.1/27523/Sun Jan 19 09:40:50 2025\n"))
+	assert.True(t, ok)
+	assert.Equal(t, Version{ClamAV: "1.4.1", Database: "27523", Date: "Sun Jan 19 09:40:50 2025"}, version)
+
+	version, ok = ParseVersion([]byte("ClamAV 0.103.12/27523"))
+	assert.True(t, ok)
+	assert.Equal(t, Version{ClamAV: "0.103.12", Database: "27523"}, version)
+
+	_, ok = ParseVersion([]byte("UNKNOWN COMMAND"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,238 @@
+package clamdconf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	log "github.com/sirupsen/logrus"
+)
+
+// errExample is returned for a configuration still containing the Example line of the sample
+// file, which clamd refuses to start with
+var errExample = errors.New("the Example line must be removed or commented out")
+
+// Config holds the options of a clamd.conf, or of a freshclam.conf which has the same syntax
+type Config struct {
+	options map[string][]string
+}
+
+// Parse reads a configuration: one option per line, followed by its value, and comments starting with #.
+// Option names are case insensitive, and some options, e.g. TCPAddr, can be repeated.
+func Parse(r io.Reader) (*Config, error) {
+	config := &Config{options: map[string][]string{}}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			name, value = line[:i], line[i+1:]
+		}
+		name = strings.ToLower(name)
+		if name == "example" {
+			return nil, errExample
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			value = value[1 : len(value)-1]
+		}
+		if value == "" {
+			return nil, fmt.Errorf("line %d: missing value of option %s", n, name)
+		}
+		config.options[name] = append(config.options[name], value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Load reads the configuration file at path
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", path, err)
+	}
+	return config, nil
+}
+
+// Get returns the last value of an option, as clamd does when a single value is expected,
+// and false when it isn't set
+func (c *Config) Get(name string) (string, bool) {
+	values := c.options[strings.ToLower(name)]
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// GetAll returns all values of a repeated option
+func (c *Config) GetAll(name string) []string {
+	return c.options[strings.ToLower(name)]
+}
+
+// Bool returns the value of a boolean option, or def when it isn't set.
+// (options: yes, no, true, false, on, off, 1, 0)
+func (c *Config) Bool(name string, def bool) (bool, error) {
+	value, ok := c.Get(name)
+	if !ok {
+		return def, nil
+	}
+	b, err := parseBool(value)
+	if err != nil {
+		return def, fmt.Errorf("%s for option %s", err, name)
+	}
+	return b, nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "true", "on", "1":
+		return true, nil
+	case "no", "false", "off", "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid boolean %q", value)
+	}
+}
+
+// Int returns the value of a numeric option, or def when it isn't set
+func (c *Config) Int(name string, def int64) (int64, error) {
+	value, ok := c.Get(name)
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return def, fmt.Errorf("invalid number %q for option %s", value, name)
+	}
+	return n, nil
+}
+
+// sizeUnits are the multipliers of the size suffixes, e.g. 25M
+var sizeUnits = map[byte]int64{
+	'k': 1 << 10,
+	'm': 1 << 20,
+	'g': 1 << 30,
+}
+
+// Size returns the value of a size option in bytes, given with an optional K, M or G suffix,
+// or def when it isn't set
+func (c *Config) Size(name string, def int64) (int64, error) {
+	value, ok := c.Get(name)
+	if !ok {
+		return def, nil
+	}
+	number, unit := value, int64(1)
+	if multiplier, ok := sizeUnits[strings.ToLower(value)[len(value)-1]]; ok {
+		number, unit = value[:len(value)-1], multiplier
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return def, fmt.Errorf("invalid size %q for option %s", value, name)
+	}
+	return n * unit, nil
+}
+
+// Targets returns the addresses clamd listens on: the LocalSocket first, as it is the cheapest
+// to connect to, then TCPSocket on each TCPAddr. clamd listens on all addresses without TCPAddr,
+// which are reached on localhost.
+func (c *Config) Targets() ([]clamav.Target, error) {
+	var targets []clamav.Target
+
+	if socket, ok := c.Get("LocalSocket"); ok {
+		targets = append(targets, clamav.Target{Scheme: clamav.SchemeUnix, Address: socket})
+	}
+
+	if port, ok := c.Get("TCPSocket"); ok {
+		addrs := c.GetAll("TCPAddr")
+		if len(addrs) == 0 {
+			addrs = []string{"localhost"}
+		}
+		for _, addr := range addrs {
+			if ip := net.ParseIP(addr); ip != nil && ip.IsUnspecified() {
+				addr = "localhost"
+			}
+			target, err := clamav.ParseTarget("tcp://" + net.JoinHostPort(addr, port))
+			if err != nil {
+				return nil, err
+			}
+			targets = append(targets, target)
+		}
+	}
+
+	if len(targets) == 0 {
+		return nil, errors.New("neither LocalSocket nor TCPSocket is set")
+	}
+	return targets, nil
+}
+
+// fileVersion identifies a version of a file by its modification time and size
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watch calls onChange with the configuration at path each time the file changes, checking it every
+// interval until stop is closed. A change is only read once the file stayed the same during an interval,
+// so that a file being written isn't read, and empty files are ignored. Invalid configurations are logged
+// and ignored.
+func Watch(path string, interval time.Duration, stop <-chan struct{}, onChange func(*Config)) {
+	version := func() fileVersion {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fileVersion{}
+		}
+		return fileVersion{modTime: info.ModTime(), size: info.Size()}
+	}
+	loaded := version()
+	var pending fileVersion
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := version()
+		if current.size == 0 || current == loaded {
+			pending = fileVersion{}
+			continue
+		}
+		if current != pending {
+			// Wait for the file to stay the same during an interval
+			pending = current
+			continue
+		}
+		loaded, pending = current, fileVersion{}
+
+		config, err := Load(path)
+		if err != nil {
+			log.Error("Error reloading configuration: ", err)
+			continue
+		}
+		log.Info("Configuration changed: ", path)
+		onChange(config)
+	}
+}
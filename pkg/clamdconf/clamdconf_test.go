@@ -0,0 +1,162 @@
+package clamdconf
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sample = `##
+## Example config file for the Clam AV daemon
+##
+
+# Comment or remove the line below.
+#Example
+
+LocalSocket "/run/clamav/clamd.ctl"
+TCPSocket 3310
+TCPAddr 0.0.0.0
+tcpaddr ::1
+TCPAddr 192.0.2.10
+	MaxThreads   12
+StreamMaxLength 25M
+ConcurrentDatabaseReload no
+Foreground yes
+MaxQueue 50
+MaxQueue 100
+`
+
+func TestParse(t *testing.T) {
+	config, err := Parse(strings.NewReader(sample))
+	assert.NoError(t, err)
+
+	value, ok := config.Get("maxthreads")
+	assert.True(t, ok)
+	assert.Equal(t, "12", value)
+	value, _ = config.Get("LocalSocket")
+	assert.Equal(t, "/run/clamav/clamd.ctl", value)
+	value, _ = config.Get("MaxQueue")
+	assert.Equal(t, "100", value, "the last value wins")
+	assert.Equal(t, []string{"0.0.0.0", "::1", "192.0.2.10"}, config.GetAll("TCPAddr"))
+
+	_, ok = config.Get("Example")
+	assert.False(t, ok)
+
+	b, err := config.Bool("ConcurrentDatabaseReload", true)
+	assert.NoError(t, err)
+	assert.False(t, b)
+	b, err = config.Bool("Foreground", false)
+	assert.NoError(t, err)
+	assert.True(t, b)
+	b, err = config.Bool("LogVerbose", true)
+	assert.NoError(t, err)
+	assert.True(t, b, "default when unset")
+	_, err = config.Bool("MaxThreads", false)
+	assert.Error(t, err)
+
+	_, err = Parse(strings.NewReader("Example\nTCPSocket 3310\n"))
+	assert.Error(t, err)
+	_, err = Parse(strings.NewReader("TCPSocket\n"))
+	assert.Error(t, err)
+}
+
+func TestTargets(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{"all", sample, []string{"unix:///run/clamav/clamd.ctl", "tcp://localhost:3310", "tcp://[::1]:3310", "tcp://192.0.2.10:3310"}},
+		{"socket", "LocalSocket /tmp/clamd.socket\n", []string{"unix:///tmp/clamd.socket"}},
+		{"tcp without address", "TCPSocket 3311\n", []string{"tcp://localhost:3311"}},
+		{"tcp on all IPv6 addresses", "TCPSocket 3310\nTCPAddr ::\n", []string{"tcp://localhost:3310"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := Parse(strings.NewReader(test.config))
+			assert.NoError(t, err)
+			targets, err := config.Targets()
+			assert.NoError(t, err)
+			var got []string
+			for _, target := range targets {
+				got = append(got, target.String())
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+
+	for _, invalid := range []string{"Foreground yes\n", "TCPSocket http\n", "TCPSocket 70000\n"} {
+		config, err := Parse(strings.NewReader(invalid))
+		assert.NoError(t, err)
+		_, err = config.Targets()
+		assert.Error(t, err, invalid)
+	}
+}
+
+// replaceFile writes a new version of path at once, as writing in place may be seen half-written
+func replaceFile(t *testing.T, path, content string) {
+	tmp := path + ".tmp"
+	assert.NoError(t, os.WriteFile(tmp, []byte(content), 0o644))
+	assert.NoError(t, os.Rename(tmp, path))
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clamd.conf")
+	replaceFile(t, path, "TCPSocket 3310\n")
+
+	changes := make(chan *Config, 10)
+	stop := make(chan struct{})
+	defer close(stop)
+	go Watch(path, 10*time.Millisecond, stop, func(config *Config) { changes <- config })
+
+	// Invalid and empty configurations are ignored
+	replaceFile(t, path, "Example\n")
+	time.Sleep(50 * time.Millisecond)
+	replaceFile(t, path, "")
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, changes, 0)
+
+	replaceFile(t, path, "LocalSocket /run/clamav/clamd.ctl\n")
+	select {
+	case config := <-changes:
+		value, _ := config.Get("LocalSocket")
+		assert.Equal(t, "/run/clamav/clamd.ctl", value)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change not seen")
+	}
+}
+
+func TestSize(t *testing.T) {
+	config, err := Parse(strings.NewReader("MaxScanSize 400M\nMaxFileSize 100k\nStreamMaxLength 1G\nMaxRecursion 17\nMaxThreads 1x\nPCREMaxFileSize -1\n"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		want int64
+		err  bool
+	}{
+		{name: "MaxScanSize", want: 400 << 20},
+		{name: "MaxFileSize", want: 100 << 10},
+		{name: "StreamMaxLength", want: 1 << 30},
+		{name: "MaxRecursion", want: 17},
+		{name: "MaxEmbeddedPE", want: 42},
+		{name: "MaxThreads", want: 42, err: true},
+		{name: "PCREMaxFileSize", want: 42, err: true},
+	}
+	for _, test := range tests {
+		size, err := config.Size(test.name, 42)
+		assert.Equal(t, test.err, err != nil, test.name)
+		assert.Equal(t, test.want, size, test.name)
+	}
+
+	n, err := config.Int("MaxRecursion", 16)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(17), n)
+	n, err = config.Int("MaxScanSize", 16)
+	assert.Error(t, err)
+	assert.Equal(t, int64(16), n)
+}
@@ -0,0 +1,165 @@
+package clamdconf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the configurations checked by a policy
+const (
+	ConfigClamd     = "clamd"
+	ConfigFreshclam = "freshclam"
+)
+
+// Values are the values allowed for a setting, given as a single value or as a list
+type Values []string
+
+// UnmarshalYAML satisfies yaml.Unmarshaler
+func (v *Values) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		*v = Values{node.Value}
+		return nil
+	case yaml.SequenceNode:
+		var values []string
+		if err := node.Decode(&values); err != nil {
+			return err
+		}
+		*v = values
+		return nil
+	default:
+		return fmt.Errorf("line %d: expected a value or a list of values", node.Line)
+	}
+}
+
+// Policy holds the settings required in clamd.conf and freshclam.conf, e.g.
+//
+//	clamd:
+//	  ScanArchive: yes
+//	  AlertEncrypted: yes
+//	freshclam:
+//	  DatabaseMirror: [mirror1.internal, mirror2.internal]
+//
+// Every value of a repeated setting must be allowed.
+type Policy struct {
+	Clamd     map[string]Values `yaml:"clamd"`
+	Freshclam map[string]Values `yaml:"freshclam"`
+}
+
+// ParsePolicy reads and validates a policy
+func ParsePolicy(r io.Reader) (*Policy, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	policy := &Policy{}
+	if err := decoder.Decode(policy); err != nil && err != io.EOF {
+		return nil, err
+	}
+	for name, settings := range policy.settings() {
+		for setting, values := range settings {
+			if len(values) == 0 {
+				return nil, fmt.Errorf("no value allowed for %s setting %s", name, setting)
+			}
+		}
+	}
+	if len(policy.Clamd) == 0 && len(policy.Freshclam) == 0 {
+		return nil, errors.New("no setting in policy")
+	}
+	return policy, nil
+}
+
+// LoadPolicy reads the policy file at path
+func LoadPolicy(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	policy, err := ParsePolicy(f)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing policy %s: %s", path, err)
+	}
+	return policy, nil
+}
+
+func (p *Policy) settings() map[string]map[string]Values {
+	return map[string]map[string]Values{
+		ConfigClamd:     p.Clamd,
+		ConfigFreshclam: p.Freshclam,
+	}
+}
+
+// Requires returns if the policy has settings for the configuration name
+func (p *Policy) Requires(name string) bool {
+	return len(p.settings()[name]) > 0
+}
+
+// Result is the check of a setting against the policy
+type Result struct {
+	Config   string   `json:"config"`
+	Setting  string   `json:"setting"`
+	Expected []string `json:"expected"`
+	Actual   []string `json:"actual"`
+	Violated bool     `json:"violated"`
+}
+
+// Report is the check of the configurations against the policy
+type Report struct {
+	Compliant  bool     `json:"compliant"`
+	Violations int      `json:"violations"`
+	Results    []Result `json:"results"`
+}
+
+// Check checks config, the configuration name (options: clamd, freshclam), against the policy.
+// Results are sorted by setting, and all settings are violated without configuration.
+func (p *Policy) Check(name string, config *Config) []Result {
+	settings := p.settings()[name]
+	results := make([]Result, 0, len(settings))
+	for setting, expected := range settings {
+		result := Result{Config: name, Setting: setting, Expected: expected, Actual: []string{}}
+		if config != nil && len(config.GetAll(setting)) > 0 {
+			result.Actual = config.GetAll(setting)
+		}
+		result.Violated = len(result.Actual) == 0
+		for _, actual := range result.Actual {
+			if !slices.ContainsFunc(expected, func(value string) bool { return equalValues(value, actual) }) {
+				result.Violated = true
+			}
+		}
+		results = append(results, result)
+	}
+	slices.SortFunc(results, func(a, b Result) int { return strings.Compare(a.Setting, b.Setting) })
+	return results
+}
+
+// NewReport gathers results in a Report
+func NewReport(results ...[]Result) Report {
+	report := Report{Results: []Result{}}
+	for _, r := range results {
+		report.Results = append(report.Results, r...)
+	}
+	for _, result := range report.Results {
+		if result.Violated {
+			report.Violations++
+		}
+	}
+	report.Compliant = report.Violations == 0
+	return report
+}
+
+// equalValues compares two values of a setting, booleans by their meaning, e.g. yes and true
+func equalValues(a, b string) bool {
+	boolA, errA := parseBool(a)
+	boolB, errB := parseBool(b)
+	if errA == nil && errB == nil {
+		return boolA == boolB
+	}
+	return strings.EqualFold(a, b)
+}
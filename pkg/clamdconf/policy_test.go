@@ -0,0 +1,67 @@
+package clamdconf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const samplePolicy = `
+clamd:
+  ScanArchive: yes
+  AlertEncrypted: true
+  MaxScanSize: 400M
+  LogSyslog: yes
+freshclam:
+  DatabaseMirror: [mirror1.internal, mirror2.internal]
+`
+
+func TestPolicy(t *testing.T) {
+	policy, err := ParsePolicy(strings.NewReader(samplePolicy))
+	assert.NoError(t, err)
+	assert.True(t, policy.Requires(ConfigClamd))
+	assert.True(t, policy.Requires(ConfigFreshclam))
+
+	clamd, err := Parse(strings.NewReader("ScanArchive true\nAlertEncrypted no\nMaxScanSize 400m\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Result{
+		{Config: ConfigClamd, Setting: "AlertEncrypted", Expected: []string{"true"}, Actual: []string{"no"}, Violated: true},
+		{Config: ConfigClamd, Setting: "LogSyslog", Expected: []string{"yes"}, Actual: []string{}, Violated: true},
+		{Config: ConfigClamd, Setting: "MaxScanSize", Expected: []string{"400M"}, Actual: []string{"400m"}},
+		{Config: ConfigClamd, Setting: "ScanArchive", Expected: []string{"yes"}, Actual: []string{"true"}},
+	}, policy.Check(ConfigClamd, clamd))
+
+	freshclam, err := Parse(strings.NewReader("DatabaseMirror mirror2.internal\nDatabaseMirror database.clamav.net\n"))
+	assert.NoError(t, err)
+	results := policy.Check(ConfigFreshclam, freshclam)
+	assert.Len(t, results, 1)
+	assert.True(t, results[0].Violated, "every mirror must be allowed")
+
+	freshclam, err = Parse(strings.NewReader("DatabaseMirror mirror2.internal\nDatabaseMirror mirror1.internal\n"))
+	assert.NoError(t, err)
+	report := NewReport(policy.Check(ConfigClamd, clamd), policy.Check(ConfigFreshclam, freshclam))
+	assert.False(t, report.Compliant)
+	assert.Equal(t, 2, report.Violations)
+	assert.Len(t, report.Results, 5)
+
+	// Without configuration, every setting is violated
+	for _, result := range policy.Check(ConfigFreshclam, nil) {
+		assert.True(t, result.Violated)
+	}
+
+	assert.True(t, NewReport().Compliant)
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	for _, invalid := range []string{
+		"",
+		"clamd: {}\n",
+		"clamav:\n  ScanArchive: yes\n",
+		"clamd:\n  ScanArchive: []\n",
+		"clamd:\n  ScanArchive: {enabled: yes}\n",
+	} {
+		_, err := ParsePolicy(strings.NewReader(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
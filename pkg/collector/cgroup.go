@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// unlimitedMemory is the lowest memory limit considered unlimited, cgroup v1 reports a page-aligned
+// maximum integer instead of max
+const unlimitedMemory = 1 << 62
+
+// CgroupMemory reads the memory limit and usage of the cgroup of clamd, from cgroup v2 or cgroup v1
+type CgroupMemory struct {
+	finder *ProcessFinder
+	root   string
+}
+
+// NewCgroupMemory creates a CgroupMemory for the process found by finder, with cgroupfs mounted on root
+func NewCgroupMemory(finder *ProcessFinder, root string) *CgroupMemory {
+	return &CgroupMemory{finder: finder, root: root}
+}
+
+// cgroupFiles are the files of the memory controller
+type cgroupFiles struct {
+	limit, usage, stat string
+	// inactiveFile is the key of the page cache which can be reclaimed in the stat file
+	inactiveFile string
+}
+
+var (
+	cgroupV2Files = cgroupFiles{limit: "memory.max", usage: "memory.current", stat: "memory.stat", inactiveFile: "inactive_file"}
+	cgroupV1Files = cgroupFiles{limit: "memory.limit_in_bytes", usage: "memory.usage_in_bytes", stat: "memory.stat", inactiveFile: "total_inactive_file"}
+)
+
+// dir returns the directory of the memory controller of clamd and its files
+func (c *CgroupMemory) dir() (string, cgroupFiles, error) {
+	p, err := c.finder.Find()
+	if err != nil {
+		return "", cgroupFiles{}, err
+	}
+	cgroups, err := p.Cgroups()
+	if err != nil {
+		return "", cgroupFiles{}, err
+	}
+
+	for _, cgroup := range cgroups {
+		var dirs []string
+		var files cgroupFiles
+		switch {
+		case cgroup.HierarchyID == 0 && len(cgroup.Controllers) == 0:
+			dirs, files = []string{filepath.Join(c.root, cgroup.Path), c.root}, cgroupV2Files
+		case slices.Contains(cgroup.Controllers, "memory"):
+			memoryRoot := filepath.Join(c.root, "memory")
+			dirs, files = []string{filepath.Join(memoryRoot, cgroup.Path), memoryRoot}, cgroupV1Files
+		default:
+			continue
+		}
+		// The path is relative to the cgroup namespace of clamd, which may not be the one of the exporter:
+		// the root is then the cgroup of the container
+		for _, dir := range dirs {
+			if _, err := os.Stat(filepath.Join(dir, files.limit)); err == nil {
+				return dir, files, nil
+			}
+		}
+	}
+	return "", cgroupFiles{}, errors.New("memory cgroup of ClamAV not found")
+}
+
+// read returns the memory limit of the cgroup of clamd, 0 when unlimited, and its working set:
+// the usage without the inactive page cache, which is reclaimed before the OOM killer is invoked
+func (c *CgroupMemory) read() (limit, workingSet float64, err error) {
+	dir, files, err := c.dir()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, files.limit))
+	if err != nil {
+		return 0, 0, err
+	}
+	if value := strings.TrimSpace(string(content)); value != "max" {
+		if limit, err = strconv.ParseFloat(value, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid memory limit %q: %s", value, err)
+		}
+		if limit >= unlimitedMemory {
+			limit = 0
+		}
+	}
+
+	content, err = os.ReadFile(filepath.Join(dir, files.usage))
+	if err != nil {
+		return 0, 0, err
+	}
+	usage, err := strconv.ParseFloat(strings.TrimSpace(string(content)), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid memory usage %q: %s", content, err)
+	}
+
+	inactive, err := readStat(filepath.Join(dir, files.stat), files.inactiveFile)
+	if err != nil {
+		return 0, 0, err
+	}
+	return limit, max(usage-inactive, 0), nil
+}
+
+// readStat returns the value of key in a memory.stat file, 0 when missing
+func readStat(path, key string) (float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), " ")
+		if ok && name == key {
+			return strconv.ParseFloat(value, 64)
+		}
+	}
+	return 0, scanner.Err()
+}
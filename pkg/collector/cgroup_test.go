@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamdconf"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeFiles creates files, by path relative to dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestCgroupMemory(t *testing.T) {
+	stats := strings.Replace(clamavtest.DefaultStats, "pools_total 1089.585M", "pools_total 512M", 1)
+
+	tests := []struct {
+		name     string
+		cgroup   map[string]string
+		config   string
+		expected string
+	}{
+		{
+			name: "v2",
+			cgroup: map[string]string{
+				"proc/42/cgroup":                            "0::/kubepods/pod1/clamd\n",
+				"cgroup/kubepods/pod1/clamd/memory.max":     "2147483648\n",
+				"cgroup/kubepods/pod1/clamd/memory.current": "1610612736\n",
+				"cgroup/kubepods/pod1/clamd/memory.stat":    "anon 1073741824\ninactive_file 536870912\n",
+			},
+			expected: `
+clamav_cgroup_memory_limit_bytes 2.147483648e+09
+clamav_cgroup_memory_working_set_bytes 1.073741824e+09
+clamav_reload_memory_headroom_bytes 5.36870912e+08
+clamav_reload_oom_predicted 0
+`,
+		},
+		{
+			name: "v1 in cgroup namespace",
+			cgroup: map[string]string{
+				"proc/42/cgroup":                      "12:memory:/docker/abc\n3:cpu,cpuacct:/docker/abc\n",
+				"cgroup/memory/memory.limit_in_bytes": "1073741824\n",
+				"cgroup/memory/memory.usage_in_bytes": "943718400\n",
+				"cgroup/memory/memory.stat":           "cache 0\ntotal_inactive_file 0\n",
+			},
+			expected: `
+clamav_cgroup_memory_limit_bytes 1.073741824e+09
+clamav_cgroup_memory_working_set_bytes 9.437184e+08
+clamav_reload_memory_headroom_bytes -4.06847488e+08
+clamav_reload_oom_predicted 1
+`,
+		},
+		{
+			name: "without concurrent reload",
+			cgroup: map[string]string{
+				"proc/42/cgroup":                      "12:memory:/\n",
+				"cgroup/memory/memory.limit_in_bytes": "1073741824\n",
+				"cgroup/memory/memory.usage_in_bytes": "943718400\n",
+				"cgroup/memory/memory.stat":           "total_inactive_file 0\n",
+			},
+			config: "ConcurrentDatabaseReload no\n",
+			expected: `
+clamav_cgroup_memory_limit_bytes 1.073741824e+09
+clamav_cgroup_memory_working_set_bytes 9.437184e+08
+clamav_reload_memory_headroom_bytes 1.30023424e+08
+clamav_reload_oom_predicted 0
+`,
+		},
+		{
+			name: "unlimited",
+			cgroup: map[string]string{
+				"proc/42/cgroup":        "0::/\n",
+				"cgroup/memory.max":     "max\n",
+				"cgroup/memory.current": "1073741824\n",
+				"cgroup/memory.stat":    "inactive_file 0\n",
+			},
+			expected: `
+clamav_cgroup_memory_working_set_bytes 1.073741824e+09
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, test.cgroup)
+			writeFiles(t, dir, map[string]string{"clamd.pid": "42\n"})
+
+			server, err := clamavtest.NewServer("tcp", "")
+			assert.NoError(t, err)
+			defer server.Close()
+			server.SetReply("STATS", stats)
+
+			finder, err := NewProcessFinder(filepath.Join(dir, "proc"), filepath.Join(dir, "clamd.pid"), "")
+			assert.NoError(t, err)
+			c := newTestCollector(server)
+			c.SetCgroupMemory(NewCgroupMemory(finder, filepath.Join(dir, "cgroup")))
+			config, err := clamdconf.Parse(strings.NewReader(test.config))
+			assert.NoError(t, err)
+			c.SetConfigCollector(NewConfigCollector(config))
+
+			help := map[string]string{
+				"clamav_cgroup_memory_limit_bytes":       "Shows the memory limit of the cgroup of ClamAV in bytes",
+				"clamav_cgroup_memory_working_set_bytes": "Shows the memory used by the cgroup of ClamAV without inactive page cache in bytes",
+				"clamav_reload_memory_headroom_bytes":    "Shows the memory left below the cgroup limit during a database reload, which needs another copy of the signatures, in bytes",
+				"clamav_reload_oom_predicted":            "Shows if a database reload is expected to exceed the memory limit of the cgroup of ClamAV",
+			}
+			var expected strings.Builder
+			for _, line := range strings.Split(strings.TrimSpace(test.expected), "\n") {
+				name, _, _ := strings.Cut(line, " ")
+				expected.WriteString("# HELP " + name + " " + help[name] + "\n# TYPE " + name + " gauge\n" + line + "\n")
+			}
+			var names []string
+			for name := range help {
+				names = append(names, name)
+			}
+			assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected.String()), names...))
+		})
+	}
+}
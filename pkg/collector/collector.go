@@ -15,64 +15,182 @@ limitations under the License.
 package collector
 
 import (
-	"bytes"
 	"math"
 	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
-	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+// Results of the database reloads recorded by ObserveReload
+const (
+	ReloadResultSuccess = "success"
+	ReloadResultTimeout = "timeout"
+	ReloadResultError   = "error"
 )
 
 // ClamavCollector satisfies prometheus.Collector interface
 type ClamavCollector struct {
-	client      clamav.Client
-	up          *prometheus.Desc
-	threadsLive *prometheus.Desc
-	threadsIdle *prometheus.Desc
-	threadsMax  *prometheus.Desc
-	queue       *prometheus.Desc
-	pool        *prometheus.Desc
-	memHeap     *prometheus.Desc
-	memMmap     *prometheus.Desc
-	memUsed     *prometheus.Desc
-	poolsUsed   *prometheus.Desc
-	poolsTotal  *prometheus.Desc
-	buildInfo   *prometheus.Desc
-	databaseAge *prometheus.Desc
+	client        clamav.Client
+	up            *prometheus.Desc
+	threadsLive   *prometheus.Desc
+	threadsIdle   *prometheus.Desc
+	threadsMax    *prometheus.Desc
+	queue         *prometheus.Desc
+	pool          *prometheus.Desc
+	memHeap       *prometheus.Desc
+	memMmap       *prometheus.Desc
+	memUsed       *prometheus.Desc
+	memFree       *prometheus.Desc
+	memReleasable *prometheus.Desc
+	poolsUsed     *prometheus.Desc
+	poolsTotal    *prometheus.Desc
+	buildInfo     *prometheus.Desc
+	databaseAge   *prometheus.Desc
+
+	streamScans        *prometheus.CounterVec
+	streamScanDuration prometheus.Histogram
+
+	reloadRequests *prometheus.CounterVec
+	reloadSuccess  prometheus.Counter
+	reloadDuration prometheus.Gauge
+
+	dataAge  *prometheus.Desc
+	cacheTTL time.Duration
+	cached   *snapshot
+	group    singleflight.Group
+	mu       sync.RWMutex
+	// now is the clock of the cache, replaced in tests
+	now func() time.Time
+
+	polling            bool
+	lastSuccessfulPoll time.Time
+	lastPoll           *prometheus.Desc
+
+	state       *prometheus.Desc
+	engineReady *prometheus.Desc
+
+	databaseAgeSource *prometheus.Desc
+	databaseAgeError  *prometheus.Desc
+	timezone          *time.Location
+	databaseDir       string
+
+	parseErrors *prometheus.CounterVec
+
+	legacyMemoryScaling bool
+
+	certExpiry *prometheus.Desc
+
+	circuitState *prometheus.Desc
+
+	poolConnections       *prometheus.Desc
+	poolDials             *prometheus.Desc
+	poolReuses            *prometheus.Desc
+	poolEvictions         *prometheus.Desc
+	poolFallbacks         *prometheus.Desc
+	poolSessionsSupported *prometheus.Desc
+
+	config            *ConfigCollector
+	threadsSaturation *prometheus.Desc
+	queueSaturation   *prometheus.Desc
+
+	cgroupMemory           *CgroupMemory
+	cgroupMemoryLimit      *prometheus.Desc
+	cgroupMemoryWorkingSet *prometheus.Desc
+	reloadHeadroom         *prometheus.Desc
+	reloadOOMPredicted     *prometheus.Desc
 }
 
+// States of the thread pool reported by the STATE line of STATS
+var states = []string{"valid", "invalid", "exit", "unknown"}
+
+// States of the circuit breaker of the client
+var circuitStates = []string{clamav.CircuitClosed, clamav.CircuitOpen, clamav.CircuitHalfOpen}
+
+// Reasons of the evictions of pooled connections
+var evictionReasons = []string{clamav.EvictionIdle, clamav.EvictionLifetime, clamav.EvictionUnhealthy, clamav.EvictionError}
+
+// Parsers of the clamd replies, as reported by clamav_parse_errors_total
+var parsers = []string{"state", "threads", "memstats", "queue", "pools", "version"}
+
 // New creates a ClamavCollector struct
 func New(client clamav.Client, report *clamav.ScanReport) (*ClamavCollector, *ClamscanCollector) {
-	return &ClamavCollector{
-			client:      client,
-			up:          prometheus.NewDesc("clamav_up", "Shows UP Status", nil, nil),
-			threadsLive: prometheus.NewDesc("clamav_threads_live", "Shows live threads", nil, nil),
-			threadsIdle: prometheus.NewDesc("clamav_threads_idle", "Shows idle threads", nil, nil),
-			threadsMax:  prometheus.NewDesc("clamav_threads_max", "Shows max threads", nil, nil),
-			queue:       prometheus.NewDesc("clamav_queue_length", "Shows queued items", nil, nil),
-			pool:        prometheus.NewDesc("clamav_pool_count", "Shows pool count", nil, nil),
-			memHeap:     prometheus.NewDesc("clamav_mem_heap_bytes", "Shows heap memory usage in bytes", nil, nil),
-			memMmap:     prometheus.NewDesc("clamav_mem_mmap_bytes", "Shows mmap memory usage in bytes", nil, nil),
-			memUsed:     prometheus.NewDesc("clamav_mem_used_bytes", "Shows used memory in bytes", nil, nil),
-			poolsUsed:   prometheus.NewDesc("clamav_pools_used_bytes", "Shows memory used by memory pool allocator for the signature database in bytes", nil, nil),
-			poolsTotal:  prometheus.NewDesc("clamav_pools_total_bytes", "Shows total memory allocated by memory pool allocator for the signature database in bytes", nil, nil),
-			buildInfo:   prometheus.NewDesc("clamav_build_info", "Shows ClamAV Build Info", []string{"clamav_version", "database_version"}, nil),
-			databaseAge: prometheus.NewDesc("clamav_database_age", "Shows ClamAV signature database age in seconds", nil, nil),
-		}, &ClamscanCollector{
-			clamScanReport:        report,
-			up:                    prometheus.NewDesc("clamscan_report_file", "Shows if report file is found", []string{"file_path"}, nil),
-			countLine:             prometheus.NewDesc("clamscan_report_file_count_line", "DEBUG: Shows how many line has been read report file", []string{"type"}, nil),
-			lastScanStartTime:     prometheus.NewDesc("clamscan_report_start_time", "Timestamp's start of last scan", nil, nil),
-			lastScanEndTime:       prometheus.NewDesc("clamscan_report_end_time", "Timestamp's end of last scan", nil, nil),
-			lastScanDuration:      prometheus.NewDesc("clamscan_report_duration", "Time duration of last scan in seconds", nil, nil),
-			lastScanStatus:        prometheus.NewDesc("clamscan_report_status", "Last scan status", nil, nil),
-			lastScanInfectedFiles: prometheus.NewDesc("clamscan_report_infected_files", "Last scan count infected files", nil, nil),
-			lastScanErrors:        prometheus.NewDesc("clamscan_report_errors", "Last scan count errors", nil, nil),
-		}
+	collector := &ClamavCollector{
+		client:                 client,
+		now:                    time.Now,
+		up:                     prometheus.NewDesc("clamav_up", "Shows if ClamAV answers PING", nil, nil),
+		state:                  prometheus.NewDesc("clamav_state", "Shows the state of the ClamAV thread pool from the STATE line of STATS", []string{"state"}, nil),
+		engineReady:            prometheus.NewDesc("clamav_engine_ready", "Shows if ClamAV is up with a valid thread pool state", nil, nil),
+		threadsLive:            prometheus.NewDesc("clamav_threads_live", "Shows live threads", nil, nil),
+		threadsIdle:            prometheus.NewDesc("clamav_threads_idle", "Shows idle threads", nil, nil),
+		threadsMax:             prometheus.NewDesc("clamav_threads_max", "Shows max threads", nil, nil),
+		queue:                  prometheus.NewDesc("clamav_queue_length", "Shows queued items", nil, nil),
+		pool:                   prometheus.NewDesc("clamav_pool_count", "Shows pool count", nil, nil),
+		memHeap:                prometheus.NewDesc("clamav_mem_heap_bytes", "Shows heap memory usage in bytes", nil, nil),
+		memMmap:                prometheus.NewDesc("clamav_mem_mmap_bytes", "Shows mmap memory usage in bytes", nil, nil),
+		memUsed:                prometheus.NewDesc("clamav_mem_used_bytes", "Shows used memory in bytes", nil, nil),
+		memFree:                prometheus.NewDesc("clamav_mem_free_bytes", "Shows free memory in bytes", nil, nil),
+		memReleasable:          prometheus.NewDesc("clamav_mem_releasable_bytes", "Shows memory which can be released to the system in bytes", nil, nil),
+		poolsUsed:              prometheus.NewDesc("clamav_pools_used_bytes", "Shows memory used by memory pool allocator for the signature database in bytes", nil, nil),
+		poolsTotal:             prometheus.NewDesc("clamav_pools_total_bytes", "Shows total memory allocated by memory pool allocator for the signature database in bytes", nil, nil),
+		buildInfo:              prometheus.NewDesc("clamav_build_info", "Shows ClamAV Build Info", []string{"clamav_version", "database_version"}, nil),
+		databaseAge:            prometheus.NewDesc("clamav_database_age", "Shows ClamAV signature database age in seconds", nil, nil),
+		databaseAgeSource:      prometheus.NewDesc("clamav_database_age_source", "Shows the source of the build time used for the database age", []string{"source"}, nil),
+		databaseAgeError:       prometheus.NewDesc("clamav_database_age_error", "Shows if the database build time couldn't be found in any source", nil, nil),
+		timezone:               time.Local,
+		dataAge:                prometheus.NewDesc("clamav_data_age_seconds", "Shows the age of the ClamAV replies served in seconds", nil, nil),
+		certExpiry:             prometheus.NewDesc("clamav_tls_cert_expiry_timestamp_seconds", "Expiry of the client certificate, and of the server certificate seen during the last TLS handshake with ClamAV", []string{"cert"}, nil),
+		circuitState:           prometheus.NewDesc("clamav_target_circuit_state", "Shows the state of the circuit breaker of the connections to ClamAV", []string{"state"}, nil),
+		poolConnections:        prometheus.NewDesc("clamav_connection_pool_connections", "Shows the connections of the pool to ClamAV by state", []string{"state"}, nil),
+		poolDials:              prometheus.NewDesc("clamav_connection_pool_dials_total", "Counts the sessions opened by the pool to ClamAV", nil, nil),
+		poolReuses:             prometheus.NewDesc("clamav_connection_pool_reuses_total", "Counts the commands sent in an already open session of the pool", nil, nil),
+		poolEvictions:          prometheus.NewDesc("clamav_connection_pool_evictions_total", "Counts the sessions of the pool closed by reason", []string{"reason"}, nil),
+		poolFallbacks:          prometheus.NewDesc("clamav_connection_pool_fallbacks_total", "Counts the commands sent without session, because the pool was full or ClamAV closes sessions", nil, nil),
+		poolSessionsSupported:  prometheus.NewDesc("clamav_connection_pool_sessions_supported", "Shows if ClamAV keeps sessions open, the pool is only used then", nil, nil),
+		threadsSaturation:      prometheus.NewDesc("clamav_threads_saturation_ratio", "Shows live threads divided by MaxThreads of clamd.conf", nil, nil),
+		queueSaturation:        prometheus.NewDesc("clamav_queue_saturation_ratio", "Shows queued items divided by MaxQueue of clamd.conf", nil, nil),
+		cgroupMemoryLimit:      prometheus.NewDesc("clamav_cgroup_memory_limit_bytes", "Shows the memory limit of the cgroup of ClamAV in bytes", nil, nil),
+		cgroupMemoryWorkingSet: prometheus.NewDesc("clamav_cgroup_memory_working_set_bytes", "Shows the memory used by the cgroup of ClamAV without inactive page cache in bytes", nil, nil),
+		reloadHeadroom:         prometheus.NewDesc("clamav_reload_memory_headroom_bytes", "Shows the memory left below the cgroup limit during a database reload, which needs another copy of the signatures, in bytes", nil, nil),
+		reloadOOMPredicted:     prometheus.NewDesc("clamav_reload_oom_predicted", "Shows if a database reload is expected to exceed the memory limit of the cgroup of ClamAV", nil, nil),
+		lastPoll:               prometheus.NewDesc("clamav_last_successful_poll_timestamp_seconds", "Timestamp of the last successful background poll of ClamAV", nil, nil),
+		streamScans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "clamav_stream_scans_total",
+			Help: "Counts scans submitted through the scan API by result",
+		}, []string{"result"}),
+		streamScanDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "clamav_stream_scan_duration_seconds",
+			Help:    "Duration of scans submitted through the scan API in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.005, 4, 8),
+		}),
+		reloadRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "clamav_reload_requests_total",
+			Help: "Counts database reloads requested through the admin API by result",
+		}, []string{"result"}),
+		reloadSuccess: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "clamav_reload_success_total",
+			Help: "Counts database reloads after which the database version changed",
+		}),
+		reloadDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "clamav_reload_duration_seconds",
+			Help: "Time between the last RELOAD and the database version change in seconds",
+		}),
+		parseErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "clamav_parse_errors_total",
+			Help: "Counts clamd replies which couldn't be parsed by parser",
+		}, []string{"parser"}),
+	}
+	for _, parser := range parsers {
+		collector.parseErrors.WithLabelValues(parser)
+	}
+	return collector, NewClamscanCollector(report)
 }
 
 // Describe satisfies prometheus.Collector.Describe
@@ -86,33 +204,191 @@ func (collector *ClamavCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- collector.memHeap
 	ch <- collector.memMmap
 	ch <- collector.memUsed
+	ch <- collector.memFree
+	ch <- collector.memReleasable
 	ch <- collector.poolsUsed
 	ch <- collector.poolsTotal
 	ch <- collector.buildInfo
 	ch <- collector.databaseAge
+	ch <- collector.databaseAgeSource
+	ch <- collector.databaseAgeError
+	ch <- collector.dataAge
+	ch <- collector.lastPoll
+	ch <- collector.state
+	ch <- collector.engineReady
+	ch <- collector.certExpiry
+	ch <- collector.circuitState
+	ch <- collector.poolConnections
+	ch <- collector.poolDials
+	ch <- collector.poolReuses
+	ch <- collector.poolEvictions
+	ch <- collector.poolFallbacks
+	ch <- collector.poolSessionsSupported
+	ch <- collector.threadsSaturation
+	ch <- collector.queueSaturation
+	ch <- collector.cgroupMemoryLimit
+	ch <- collector.cgroupMemoryWorkingSet
+	ch <- collector.reloadHeadroom
+	ch <- collector.reloadOOMPredicted
+	collector.streamScans.Describe(ch)
+	collector.streamScanDuration.Describe(ch)
+	collector.reloadRequests.Describe(ch)
+	collector.reloadSuccess.Describe(ch)
+	collector.reloadDuration.Describe(ch)
+	collector.parseErrors.Describe(ch)
 }
 
 // Collect satisfies prometheus.Collector.Collect
 func (collector *ClamavCollector) Collect(ch chan<- prometheus.Metric) {
-	pong := collector.client.Dial(commands.PING)
-	if bytes.Equal(pong, []byte{'P', 'O', 'N', 'G', '\n'}) {
+	collector.streamScans.Collect(ch)
+	collector.streamScanDuration.Collect(ch)
+	collector.reloadRequests.Collect(ch)
+	collector.reloadSuccess.Collect(ch)
+	collector.reloadDuration.Collect(ch)
+
+	s := collector.snapshot()
+	ch <- prometheus.MustNewConstMetric(collector.dataAge, prometheus.GaugeValue, collector.now().Sub(s.time).Seconds())
+	if collector.polling {
+		collector.mu.RLock()
+		lastSuccessfulPoll := collector.lastSuccessfulPoll
+		collector.mu.RUnlock()
+		if !lastSuccessfulPoll.IsZero() {
+			ch <- prometheus.MustNewConstMetric(collector.lastPoll, prometheus.GaugeValue, float64(lastSuccessfulPoll.Unix()))
+		}
+	}
+
+	up := strings.TrimRight(string(s.pong), "\x00\n ") == "PONG"
+	if up {
 		ch <- prometheus.MustNewConstMetric(collector.up, prometheus.GaugeValue, 1)
 	} else {
 		ch <- prometheus.MustNewConstMetric(collector.up, prometheus.GaugeValue, 0)
 	}
 
-	stats := collector.client.Dial(commands.STATS)
-	idle, err := regexp.MatchString("IDLE", string(stats))
-	if err != nil {
-		log.Errorf(`error searching IDLE field in stats %v: %s`, idle, err)
+	stats := string(s.stats)
+	collector.CollectState(ch, up, stats)
+	collector.CollectMemoryStats(ch, stats)
+	collector.CollectThreads(ch, stats)
+	collector.CollectQueue(ch, stats)
+	collector.CollectPools(ch, stats)
+	collector.CollectBuildInfo(ch, string(s.version))
+	collector.CollectCertExpiry(ch)
+	collector.CollectCircuitState(ch)
+	collector.CollectPoolStats(ch)
+	collector.parseErrors.Collect(ch)
+}
+
+// CollectPoolStats exports the statistics of the connection pool of the client, when enabled
+func (collector *ClamavCollector) CollectPoolStats(ch chan<- prometheus.Metric) {
+	stats, ok := collector.client.PoolStats()
+	if !ok {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(collector.poolConnections, prometheus.GaugeValue, float64(stats.Idle), "idle")
+	ch <- prometheus.MustNewConstMetric(collector.poolConnections, prometheus.GaugeValue, float64(stats.Active), "active")
+	ch <- prometheus.MustNewConstMetric(collector.poolDials, prometheus.CounterValue, float64(stats.Dials))
+	ch <- prometheus.MustNewConstMetric(collector.poolReuses, prometheus.CounterValue, float64(stats.Reuses))
+	for _, reason := range evictionReasons {
+		ch <- prometheus.MustNewConstMetric(collector.poolEvictions, prometheus.CounterValue, float64(stats.Evictions[reason]), reason)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.poolFallbacks, prometheus.CounterValue, float64(stats.Fallbacks))
+	if stats.Unsupported {
+		ch <- prometheus.MustNewConstMetric(collector.poolSessionsSupported, prometheus.GaugeValue, 0)
+	} else {
+		ch <- prometheus.MustNewConstMetric(collector.poolSessionsSupported, prometheus.GaugeValue, 1)
+	}
+}
+
+// CollectCircuitState exports the state of the circuit breaker of the client as an enum, when enabled
+func (collector *ClamavCollector) CollectCircuitState(ch chan<- prometheus.Metric) {
+	state := collector.client.CircuitState()
+	if state == "" {
 		return
 	}
+	for _, s := range circuitStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(collector.circuitState, prometheus.GaugeValue, value, s)
+	}
+}
+
+// CollectCertExpiry exports the expiry of the TLS certificates of the connection to ClamAV, when known
+func (collector *ClamavCollector) CollectCertExpiry(ch chan<- prometheus.Metric) {
+	client, server := collector.client.CertExpiry()
+	if !client.IsZero() {
+		ch <- prometheus.MustNewConstMetric(collector.certExpiry, prometheus.GaugeValue, float64(client.Unix()), "client")
+	}
+	if !server.IsZero() {
+		ch <- prometheus.MustNewConstMetric(collector.certExpiry, prometheus.GaugeValue, float64(server.Unix()), "server")
+	}
+}
+
+// SetDatabaseAgeSources sets the time zone of the VERSION date, and the directory of the database
+// files used when VERSION has no date
+func (collector *ClamavCollector) SetDatabaseAgeSources(timezone *time.Location, databaseDir string) {
+	collector.timezone = timezone
+	collector.databaseDir = databaseDir
+}
 
-	collector.CollectMemoryStats(ch, string(stats))
-	collector.CollectThreads(ch, string(stats))
-	collector.CollectQueue(ch, string(stats))
-	collector.CollectPools(ch, string(stats))
-	collector.CollectBuildInfo(ch)
+// SetLegacyMemoryScaling exports the memory stats multiplied by 1024 regardless of their unit, as
+// before they were converted to bytes, for dashboards which still expect the old values
+func (collector *ClamavCollector) SetLegacyMemoryScaling(legacy bool) {
+	collector.legacyMemoryScaling = legacy
+}
+
+// SetConfigCollector exports the saturation of the threads and queue, compared with the limits of the
+// clamd.conf read by config
+func (collector *ClamavCollector) SetConfigCollector(config *ConfigCollector) {
+	collector.config = config
+}
+
+// collectSaturation exports value divided by limit, when clamd.conf is known
+func (collector *ClamavCollector) collectSaturation(ch chan<- prometheus.Metric, desc *prometheus.Desc, value string, limit func(limits) int64) {
+	if collector.config == nil {
+		return
+	}
+	if l := limit(collector.config.current()); l > 0 {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float(value)/float64(l))
+	}
+}
+
+// SetCgroupMemory exports the memory of the cgroup of ClamAV read by cgroupMemory, and the headroom
+// for database reloads
+func (collector *ClamavCollector) SetCgroupMemory(cgroupMemory *CgroupMemory) {
+	collector.cgroupMemory = cgroupMemory
+}
+
+// ObserveScan records the result and duration of a scan submitted through the scan API
+func (collector *ClamavCollector) ObserveScan(result string, duration time.Duration) {
+	collector.streamScans.WithLabelValues(result).Inc()
+	collector.streamScanDuration.Observe(duration.Seconds())
+}
+
+// ObserveReload records the result of a database reload requested through the admin API
+func (collector *ClamavCollector) ObserveReload(result string, duration time.Duration) {
+	collector.reloadRequests.WithLabelValues(result).Inc()
+	if result == ReloadResultSuccess {
+		collector.reloadSuccess.Inc()
+		collector.reloadDuration.Set(duration.Seconds())
+	}
+}
+
+// parseError counts a section of a reply which is present but can't be parsed, instead of failing the whole scrape
+func (collector *ClamavCollector) parseError(parser string, section string) {
+	log.Errorf("Error parsing %s: %q", parser, section)
+	collector.parseErrors.WithLabelValues(parser).Inc()
+}
+
+// statsLine returns the line of STATS starting with prefix, e.g. "THREADS:", without the prefix
+func statsLine(stats string, prefix string) (string, bool) {
+	for _, l := range strings.Split(stats, "\n") {
+		if after, ok := strings.CutPrefix(strings.TrimSpace(l), prefix); ok {
+			return after, true
+		}
+	}
+	return "", false
 }
 
 func float(s string) float64 {
@@ -123,101 +399,284 @@ func float(s string) float64 {
 	return float
 }
 
+// CollectState exports the state of the thread pool, e.g. "STATE: VALID PRIMARY", as an enum
+func (collector *ClamavCollector) CollectState(ch chan<- prometheus.Metric, up bool, stats string) {
+	if stats == "" {
+		ch <- prometheus.MustNewConstMetric(collector.engineReady, prometheus.GaugeValue, 0)
+		return
+	}
+
+	state := "unknown"
+	if line, ok := statsLine(stats, "STATE:"); ok {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && slices.Contains(states, strings.ToLower(fields[0])) {
+			state = strings.ToLower(fields[0])
+		} else {
+			collector.parseError("state", line)
+		}
+	}
+
+	log.Debug("State: ", state)
+
+	for _, s := range states {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(collector.state, prometheus.GaugeValue, value, s)
+	}
+
+	if up && state == "valid" {
+		ch <- prometheus.MustNewConstMetric(collector.engineReady, prometheus.GaugeValue, 1)
+	} else {
+		ch <- prometheus.MustNewConstMetric(collector.engineReady, prometheus.GaugeValue, 0)
+	}
+}
+
+// memstatsRegex matches the fields of the MEMSTATS line, e.g. "heap 3.656M" or "heap N/A"
+var memstatsRegex = regexp.MustCompile(`(\S+)\s+([0-9.]+[KMG]?|N/A)`)
+
+// memoryUnits are the multipliers of the unit suffixes of MEMSTATS values
+var memoryUnits = map[byte]float64{'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30}
+
+// memoryBytes converts a MEMSTATS value, e.g. "3.656M", into bytes
+func (collector *ClamavCollector) memoryBytes(value string) float64 {
+	if collector.legacyMemoryScaling {
+		return float(strings.TrimRight(value, "KMG")) * 1024
+	}
+	return unitBytes(value)
+}
+
+// unitBytes converts a MEMSTATS value to bytes from its unit
+func unitBytes(value string) float64 {
+	unit := 1.0
+	if n := len(value); n > 0 {
+		if multiplier, ok := memoryUnits[value[n-1]]; ok {
+			unit = multiplier
+			value = value[:n-1]
+		}
+	}
+	return float(value) * unit
+}
+
+// CollectMemoryStats exports the MEMSTATS line of STATS, e.g.
+// MEMSTATS: heap 3.656M mmap 0.129M used 3.236M free 0.420M releasable 0.127M pools 1 pools_used 1089.550M pools_total 1089.585M
+// Without mallinfo, e.g. with musl, heap, mmap, used, free and releasable are N/A.
 func (collector *ClamavCollector) CollectMemoryStats(ch chan<- prometheus.Metric, stats string) {
-	regex := regexp.MustCompile(`(?:MEMSTATS:\sheap|mmap|used|free|releasable|pools|pools_used|pools_total)\s+([0-9.]+|N\/A)+`)
-	matches := regex.FindAllStringSubmatch(stats, -1)
+	line, present := statsLine(stats, "MEMSTATS:")
+	fields := map[string]string{}
+	for _, match := range memstatsRegex.FindAllStringSubmatch(line, -1) {
+		fields[match[1]] = match[2]
+	}
 
-	log.Debug("Matches Memory Stats", matches)
+	log.Debug("Matches Memory Stats", fields)
 
 	// MEMORY STATS
-	if len(matches) > 0 {
-		ch <- prometheus.MustNewConstMetric(collector.memHeap, prometheus.GaugeValue, float(matches[0][1])*1024)
-		log.Debug("memHeap: ", float(matches[1][1])*1024)
-		ch <- prometheus.MustNewConstMetric(collector.memMmap, prometheus.GaugeValue, float(matches[1][1])*1024)
-		log.Debug("memMmap: ", float(matches[2][1])*1024)
-		ch <- prometheus.MustNewConstMetric(collector.memUsed, prometheus.GaugeValue, float(matches[2][1])*1024)
-		log.Debug("memUsed: ", float(matches[3][1])*1024)
-		ch <- prometheus.MustNewConstMetric(collector.poolsUsed, prometheus.GaugeValue, float(matches[6][1])*1024)
-		log.Debug("poolsUsed: ", float(matches[6][1])*1024)
-		ch <- prometheus.MustNewConstMetric(collector.poolsTotal, prometheus.GaugeValue, float(matches[7][1])*1024)
-		log.Debug("poolsTotal: ", float(matches[7][1])*1024)
+	missing := false
+	for _, field := range []struct {
+		name string
+		desc *prometheus.Desc
+	}{
+		{"heap", collector.memHeap},
+		{"mmap", collector.memMmap},
+		{"used", collector.memUsed},
+		{"free", collector.memFree},
+		{"releasable", collector.memReleasable},
+		{"pools_used", collector.poolsUsed},
+		{"pools_total", collector.poolsTotal},
+	} {
+		if value, ok := fields[field.name]; ok {
+			ch <- prometheus.MustNewConstMetric(field.desc, prometheus.GaugeValue, collector.memoryBytes(value))
+			log.Debug(field.name, ": ", collector.memoryBytes(value))
+		} else {
+			missing = true
+		}
+	}
+	if present && missing {
+		collector.parseError("memstats", line)
+	}
+
+	poolsTotal := math.NaN()
+	if value, ok := fields["pools_total"]; ok {
+		poolsTotal = unitBytes(value)
+	}
+	collector.CollectReloadHeadroom(ch, poolsTotal)
+}
+
+// CollectReloadHeadroom exports the memory of the cgroup of ClamAV, when enabled, and the memory left during a
+// database reload. The reload loads a new copy of the signatures, poolsTotal bytes, before releasing the
+// previous one, unless ConcurrentDatabaseReload is disabled.
+func (collector *ClamavCollector) CollectReloadHeadroom(ch chan<- prometheus.Metric, poolsTotal float64) {
+	if collector.cgroupMemory == nil {
+		return
+	}
+	limit, workingSet, err := collector.cgroupMemory.read()
+	if err != nil {
+		log.Debug("Error reading memory cgroup of ClamAV: ", err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collector.cgroupMemoryWorkingSet, prometheus.GaugeValue, workingSet)
+	if limit == 0 {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collector.cgroupMemoryLimit, prometheus.GaugeValue, limit)
+	if math.IsNaN(poolsTotal) {
+		return
+	}
+
+	reloadMemory := poolsTotal
+	if collector.config != nil && !collector.config.current().concurrentDatabaseReload {
+		reloadMemory = 0
+	}
+	headroom := limit - workingSet - reloadMemory
+	ch <- prometheus.MustNewConstMetric(collector.reloadHeadroom, prometheus.GaugeValue, headroom)
+	if headroom < 0 {
+		ch <- prometheus.MustNewConstMetric(collector.reloadOOMPredicted, prometheus.GaugeValue, 1)
+	} else {
+		ch <- prometheus.MustNewConstMetric(collector.reloadOOMPredicted, prometheus.GaugeValue, 0)
+	}
+}
+
+// threadsRegex matches the fields of the THREADS line, e.g. "live 1" or "idle-timeout 30"
+var threadsRegex = regexp.MustCompile(`(\S+)\s+([0-9]+)`)
+
+// threads corresponds to the THREADS line of STATS
+type threads struct {
+	live string
+	idle string
+	max  string
+}
+
+// parseThreads parses the THREADS line of STATS, e.g.
+// THREADS: live 1  idle 0 max 12 idle-timeout 30
+func parseThreads(stats string) (threads, bool) {
+	line, _ := statsLine(stats, "THREADS:")
+	fields := map[string]string{}
+	for _, match := range threadsRegex.FindAllStringSubmatch(line, -1) {
+		fields[match[1]] = match[2]
+	}
+
+	t := threads{live: fields["live"], idle: fields["idle"], max: fields["max"]}
+	if t.live == "" || t.idle == "" || t.max == "" {
+		return threads{}, false
 	}
+	return t, true
 }
 
 func (collector *ClamavCollector) CollectThreads(ch chan<- prometheus.Metric, stats string) {
-	regex := regexp.MustCompile(`(?:THREADS:\slive|idle|max|idle-timeout)\s+([0-9.]+|N\/A)+`)
-	matches := regex.FindAllStringSubmatch(stats, -1)
+	t, ok := parseThreads(stats)
 
-	log.Debug("Matches Threads", matches)
+	log.Debug("Threads: ", t)
 
 	// THREADS
-	if len(matches) > 0 {
-		ch <- prometheus.MustNewConstMetric(collector.threadsLive, prometheus.GaugeValue, float(matches[0][1]))
-		log.Debug("threadsLive: ", float(matches[0][1]))
-		ch <- prometheus.MustNewConstMetric(collector.threadsIdle, prometheus.GaugeValue, float(matches[1][1]))
-		log.Debug("threadsIdle: ", float(matches[1][1]))
-		ch <- prometheus.MustNewConstMetric(collector.threadsMax, prometheus.GaugeValue, float(matches[2][1]))
-		log.Debug("threadsMax: ", float(matches[2][1]))
+	if ok {
+		ch <- prometheus.MustNewConstMetric(collector.threadsLive, prometheus.GaugeValue, float(t.live))
+		ch <- prometheus.MustNewConstMetric(collector.threadsIdle, prometheus.GaugeValue, float(t.idle))
+		ch <- prometheus.MustNewConstMetric(collector.threadsMax, prometheus.GaugeValue, float(t.max))
+		collector.collectSaturation(ch, collector.threadsSaturation, t.live, func(l limits) int64 { return l.maxThreads })
+	} else if line, present := statsLine(stats, "THREADS:"); present {
+		collector.parseError("threads", line)
 	}
 }
 
+// queueRegex matches the QUEUE line of STATS, e.g. "QUEUE: 0 items"
+var queueRegex = regexp.MustCompile(`^([0-9]+)\s+items`)
+
+// poolsRegex matches the POOLS line of STATS, e.g. "POOLS: 1"
+var poolsRegex = regexp.MustCompile(`^([0-9]+)$`)
+
 func (collector *ClamavCollector) CollectQueue(ch chan<- prometheus.Metric, stats string) {
-	regex := regexp.MustCompile(`(?:QUEUE:|FILDES|STATS)\s+([0-9.]+|N\/A)`)
-	matches := regex.FindAllStringSubmatch(stats, -1)
+	line, present := statsLine(stats, "QUEUE:")
+	if !present {
+		return
+	}
+	matches := queueRegex.FindStringSubmatch(strings.TrimSpace(line))
 
 	log.Debug("Matches Queue", matches)
 
 	// QUEUE
-	if len(matches) > 0 {
-		ch <- prometheus.MustNewConstMetric(collector.queue, prometheus.GaugeValue, float(matches[0][1]))
-		log.Debug("queue: ", float(matches[0][1]))
+	if matches == nil {
+		collector.parseError("queue", line)
+		return
 	}
+	ch <- prometheus.MustNewConstMetric(collector.queue, prometheus.GaugeValue, float(matches[1]))
+	log.Debug("queue: ", float(matches[1]))
+	collector.collectSaturation(ch, collector.queueSaturation, matches[1], func(l limits) int64 { return l.maxQueue })
 }
 
 func (collector *ClamavCollector) CollectPools(ch chan<- prometheus.Metric, stats string) {
-	// regex := regexp.MustCompile(`(?:QUEUE:|FILDES|STATS)\s+([0-9.]+|N\/A)`)
-	regex := regexp.MustCompile(`POOLS:\s+([0-9.]+|N\/A)`)
-	matches := regex.FindAllStringSubmatch(stats, -1)
+	line, present := statsLine(stats, "POOLS:")
+	if !present {
+		return
+	}
+	matches := poolsRegex.FindStringSubmatch(strings.TrimSpace(line))
 
 	log.Debug("Matches Pools", matches)
 
 	// POOLS
-	if len(matches) > 0 {
-		ch <- prometheus.MustNewConstMetric(collector.pool, prometheus.GaugeValue, float(matches[0][1]))
-		log.Debug("pools: ", float(matches[0][1]))
+	if matches == nil {
+		collector.parseError("pools", line)
+		return
 	}
+	ch <- prometheus.MustNewConstMetric(collector.pool, prometheus.GaugeValue, float(matches[1]))
+	log.Debug("pools: ", float(matches[1]))
 }
 
-func (collector *ClamavCollector) CollectBuildInfo(ch chan<- prometheus.Metric) {
-	// The return of this should be something like: ClamAV 1.4.1/27523/Sun Jan 19 09:40:50 2025
-	version := collector.client.Dial(commands.VERSION)
-	regex := regexp.MustCompile(`ClamAV\s([0-9.]*)/(\d+)/(.+)`)
+func (collector *ClamavCollector) CollectBuildInfo(ch chan<- prometheus.Metric, versionReply string) {
+	version, ok := clamav.ParseVersion([]byte(versionReply))
 
-	// The match will be a list of four elements:
-	// length=4 => [0]: ClamAV, [1]: 1.4.1, [2]: 27523, [3]: Sun Jan 19 09:40:50 2025
-	matches := regex.FindStringSubmatch(string(version))
+	log.Debug("Version: ", version)
 
-	log.Debug("Matches Version", matches)
+	if ok {
+		ch <- prometheus.MustNewConstMetric(collector.buildInfo, prometheus.GaugeValue, 1, version.ClamAV, version.Database)
+	} else if versionReply != "" {
+		collector.parseError("version", versionReply)
+	}
 
-	if len(matches) >= 3 {
-		ch <- prometheus.MustNewConstMetric(collector.buildInfo, prometheus.GaugeValue, 1, matches[1], matches[2])
+	// Without reply, clamav_up already shows that clamd is unreachable, the age is unknown rather than in error
+	if versionReply == "" && collector.databaseDir == "" {
+		log.Debug("No reply to VERSION, skipping database age")
+		return
+	}
+	collector.CollectDatabaseAge(ch, version)
+}
 
-		strBuilddate := time.Now().UTC().String()
+// CollectDatabaseAge exports the age of the database from the date of VERSION, or else from the
+// database files. When no source is available, an error is exported instead of the age.
+func (collector *ClamavCollector) CollectDatabaseAge(ch chan<- prometheus.Metric, version clamav.Version) {
+	var buildTime time.Time
+	var source string
 
-		// If the regular expression match returns a list with length 4,
-		// it means that the VERSION command return has a date.
-		// Otherwise, it ignores it and uses the current time.
-		if len(matches) == 4 {
-			strBuilddate = matches[3]
+	if version.Date != "" {
+		var err error
+		buildTime, err = clamav.ParseVersionDate(version.Date, collector.timezone)
+		if err != nil {
+			log.Error("Error parsing ClamAV date: ", err)
+		} else {
+			source = clamav.DatabaseSourceVersion
 		}
+	}
 
-		// Parse string as date type based on RFC850
-		builddate, err := time.Parse("Mon Jan 2 15:04:05 2006", strBuilddate)
-
+	if source == "" && collector.databaseDir != "" {
+		var err error
+		buildTime, source, err = clamav.DatabaseBuildTime(collector.databaseDir)
 		if err != nil {
-			log.Error("Error parsing ClamAV date: ", err)
+			log.Debug("Error reading database build time: ", err)
 		}
+	}
 
-		ch <- prometheus.MustNewConstMetric(collector.databaseAge, prometheus.GaugeValue, time.Since(builddate).Seconds())
+	if source == "" {
+		ch <- prometheus.MustNewConstMetric(collector.databaseAgeError, prometheus.GaugeValue, 1)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(collector.databaseAgeError, prometheus.GaugeValue, 0)
+	for _, s := range []string{clamav.DatabaseSourceVersion, clamav.DatabaseSourceCVDHeader, clamav.DatabaseSourceFreshclam} {
+		value := 0.0
+		if s == source {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(collector.databaseAgeSource, prometheus.GaugeValue, value, s)
 	}
+	ch <- prometheus.MustNewConstMetric(collector.databaseAge, prometheus.GaugeValue, time.Since(buildTime).Seconds())
 }
@@ -0,0 +1,412 @@
+package collector
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamdconf"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCollector(server *clamavtest.Server) *ClamavCollector {
+	clamavCollector, _ := New(*clamav.New(server.Address, server.Network), clamav.NewScanReport(""))
+	return clamavCollector
+}
+
+func TestCollectorState(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(*clamavtest.Server)
+		up         string
+		state      string
+		ready      string
+		hasThreads bool
+	}{
+		{
+			name:       "valid",
+			setup:      func(*clamavtest.Server) {},
+			up:         "1",
+			state:      "valid",
+			ready:      "1",
+			hasThreads: true,
+		},
+		{
+			name: "invalid",
+			setup: func(s *clamavtest.Server) {
+				s.SetReply("STATS", strings.Replace(clamavtest.DefaultStats, "STATE: VALID", "STATE: INVALID", 1))
+			},
+			up:         "1",
+			state:      "invalid",
+			ready:      "0",
+			hasThreads: true,
+		},
+		{
+			name: "malformed",
+			setup: func(s *clamavtest.Server) {
+				s.SetReply("STATS", "garbage")
+			},
+			up:    "1",
+			state: "unknown",
+			ready: "0",
+		},
+		{
+			name: "disconnect",
+			setup: func(s *clamavtest.Server) {
+				s.SetDisconnect("PING", true)
+			},
+			up:         "0",
+			state:      "valid",
+			ready:      "0",
+			hasThreads: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, err := clamavtest.NewServer("tcp", "")
+			assert.NoError(t, err)
+			defer server.Close()
+			test.setup(server)
+
+			expected := `
+# HELP clamav_engine_ready Shows if ClamAV is up with a valid thread pool state
+# TYPE clamav_engine_ready gauge
+clamav_engine_ready ` + test.ready + `
+# HELP clamav_up Shows if ClamAV answers PING
+# TYPE clamav_up gauge
+clamav_up ` + test.up + `
+`
+			c := newTestCollector(server)
+			assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected), "clamav_up", "clamav_engine_ready"))
+
+			state := `clamav_state{state="` + test.state + `"} 1`
+			metrics, err := testutil.CollectAndFormat(c, expfmt.TypeTextPlain, "clamav_state")
+			assert.NoError(t, err)
+			assert.Contains(t, string(metrics), state)
+
+			assert.Equal(t, test.hasThreads, testutil.CollectAndCount(c, "clamav_threads_live") == 1)
+		})
+	}
+}
+
+// collectParsed runs collect and returns the metrics sent, checking that each one is valid
+func collectParsed(t *testing.T, collect func(ch chan<- prometheus.Metric)) {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for metric := range ch {
+			assert.NoError(t, metric.Write(&dto.Metric{}))
+		}
+	}()
+	collect(ch)
+	close(ch)
+	<-done
+}
+
+func TestCollectorCircuitState(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	server.SetDisconnect("PING", true)
+
+	client := clamav.New(server.Address, server.Network)
+	client.SetCircuitBreaker(1, time.Hour)
+	c, _ := New(*client, clamav.NewScanReport(""))
+
+	expected := `
+# HELP clamav_target_circuit_state Shows the state of the circuit breaker of the connections to ClamAV
+# TYPE clamav_target_circuit_state gauge
+clamav_target_circuit_state{state="closed"} 0
+clamav_target_circuit_state{state="half_open"} 0
+clamav_target_circuit_state{state="open"} 1
+# HELP clamav_up Shows if ClamAV answers PING
+# TYPE clamav_up gauge
+clamav_up 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected), "clamav_up", "clamav_target_circuit_state"))
+	// PING opened the circuit, so STATS and VERSION weren't sent
+	assert.Equal(t, []string{"PING"}, server.Requests())
+}
+
+func TestCollectDatabaseAgeWithoutReply(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	c := newTestCollector(server)
+	names := []string{"clamav_database_age", "clamav_database_age_source", "clamav_database_age_error"}
+
+	// clamd is unreachable: the age is unknown, not in error
+	server.SetDisconnect("VERSION", true)
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(""), names...))
+
+	// clamd answers without date
+	server.SetDisconnect("VERSION", false)
+	server.SetReply("VERSION", "garbage")
+	expected := `
+# HELP clamav_database_age_error Shows if the database build time couldn't be found in any source
+# TYPE clamav_database_age_error gauge
+clamav_database_age_error 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected), names...))
+}
+
+func TestConfigCollector(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	server.SetReply("STATS", strings.Replace(clamavtest.DefaultStats, "QUEUE: 0 items", "QUEUE: 5 items", 1))
+
+	config, err := clamdconf.Parse(strings.NewReader("MaxThreads 4\nMaxQueue 50\nStreamMaxLength 25M\nConcurrentDatabaseReload no\n"))
+	assert.NoError(t, err)
+	configCollector := NewConfigCollector(config)
+	c := newTestCollector(server)
+	c.SetConfigCollector(configCollector)
+
+	expected := `
+# HELP clamav_config_concurrent_database_reload Shows if ConcurrentDatabaseReload of clamd.conf is enabled
+# TYPE clamav_config_concurrent_database_reload gauge
+clamav_config_concurrent_database_reload 0
+# HELP clamav_config_max_queue Shows MaxQueue of clamd.conf
+# TYPE clamav_config_max_queue gauge
+clamav_config_max_queue 50
+# HELP clamav_config_max_scan_size_bytes Shows MaxScanSize of clamd.conf in bytes, 0 is unlimited
+# TYPE clamav_config_max_scan_size_bytes gauge
+clamav_config_max_scan_size_bytes 4.194304e+08
+# HELP clamav_config_max_threads Shows MaxThreads of clamd.conf
+# TYPE clamav_config_max_threads gauge
+clamav_config_max_threads 4
+# HELP clamav_config_stream_max_length_bytes Shows StreamMaxLength of clamd.conf in bytes
+# TYPE clamav_config_stream_max_length_bytes gauge
+clamav_config_stream_max_length_bytes 2.62144e+07
+`
+	assert.NoError(t, testutil.CollectAndCompare(configCollector, strings.NewReader(expected)))
+
+	expected = `
+# HELP clamav_queue_saturation_ratio Shows queued items divided by MaxQueue of clamd.conf
+# TYPE clamav_queue_saturation_ratio gauge
+clamav_queue_saturation_ratio 0.1
+# HELP clamav_threads_saturation_ratio Shows live threads divided by MaxThreads of clamd.conf
+# TYPE clamav_threads_saturation_ratio gauge
+clamav_threads_saturation_ratio 0.25
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected), "clamav_queue_saturation_ratio", "clamav_threads_saturation_ratio"))
+
+	// Invalid values keep the defaults of ClamAV
+	config, err = clamdconf.Parse(strings.NewReader("MaxThreads many\n"))
+	assert.NoError(t, err)
+	configCollector.SetConfig(config)
+	expected = `
+# HELP clamav_config_max_threads Shows MaxThreads of clamd.conf
+# TYPE clamav_config_max_threads gauge
+clamav_config_max_threads 10
+# HELP clamav_config_max_queue Shows MaxQueue of clamd.conf
+# TYPE clamav_config_max_queue gauge
+clamav_config_max_queue 100
+`
+	assert.NoError(t, testutil.CollectAndCompare(configCollector, strings.NewReader(expected), "clamav_config_max_threads", "clamav_config_max_queue"))
+}
+
+func TestPolicyCollector(t *testing.T) {
+	policy, err := clamdconf.ParsePolicy(strings.NewReader("clamd:\n  ScanArchive: yes\n  AlertEncrypted: yes\nfreshclam:\n  DatabaseMirror: mirror.internal\n"))
+	assert.NoError(t, err)
+	c := NewPolicyCollector(policy)
+	config, err := clamdconf.Parse(strings.NewReader("ScanArchive yes\nAlertEncrypted no\n"))
+	assert.NoError(t, err)
+	c.SetConfig(clamdconf.ConfigClamd, config)
+
+	expected := `
+# HELP clamav_config_policy_violation Shows if a setting of clamd.conf or freshclam.conf violates the policy
+# TYPE clamav_config_policy_violation gauge
+clamav_config_policy_violation{config="clamd",setting="AlertEncrypted"} 1
+clamav_config_policy_violation{config="clamd",setting="ScanArchive"} 0
+clamav_config_policy_violation{config="freshclam",setting="DatabaseMirror"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(expected)))
+
+	config, err = clamdconf.Parse(strings.NewReader("DatabaseMirror mirror.internal\n"))
+	assert.NoError(t, err)
+	c.SetConfig(clamdconf.ConfigFreshclam, config)
+	report := c.PolicyReport()
+	assert.False(t, report.Compliant)
+	assert.Equal(t, 1, report.Violations)
+}
+
+func TestCollectMemoryStats(t *testing.T) {
+	stats := "MEMSTATS: heap 3.656M mmap 128K used 1G free N/A releasable 0.127M pools 1 pools_used 1089.550M pools_total 1089.585M\nEND"
+	tests := []struct {
+		legacy   bool
+		expected string
+	}{
+		{
+			expected: `
+# HELP clamav_mem_free_bytes Shows free memory in bytes
+# TYPE clamav_mem_free_bytes gauge
+clamav_mem_free_bytes NaN
+# HELP clamav_mem_heap_bytes Shows heap memory usage in bytes
+# TYPE clamav_mem_heap_bytes gauge
+clamav_mem_heap_bytes 3.833593856e+06
+# HELP clamav_mem_mmap_bytes Shows mmap memory usage in bytes
+# TYPE clamav_mem_mmap_bytes gauge
+clamav_mem_mmap_bytes 131072
+# HELP clamav_mem_used_bytes Shows used memory in bytes
+# TYPE clamav_mem_used_bytes gauge
+clamav_mem_used_bytes 1.073741824e+09
+`,
+		},
+		{
+			legacy: true,
+			expected: `
+# HELP clamav_mem_free_bytes Shows free memory in bytes
+# TYPE clamav_mem_free_bytes gauge
+clamav_mem_free_bytes NaN
+# HELP clamav_mem_heap_bytes Shows heap memory usage in bytes
+# TYPE clamav_mem_heap_bytes gauge
+clamav_mem_heap_bytes 3743.744
+# HELP clamav_mem_mmap_bytes Shows mmap memory usage in bytes
+# TYPE clamav_mem_mmap_bytes gauge
+clamav_mem_mmap_bytes 131072
+# HELP clamav_mem_used_bytes Shows used memory in bytes
+# TYPE clamav_mem_used_bytes gauge
+clamav_mem_used_bytes 1024
+`,
+		},
+	}
+
+	for _, test := range tests {
+		server, err := clamavtest.NewServer("tcp", "")
+		assert.NoError(t, err)
+		defer server.Close()
+		server.SetReply("STATS", stats)
+
+		c := newTestCollector(server)
+		c.SetLegacyMemoryScaling(test.legacy)
+		assert.NoError(t, testutil.CollectAndCompare(c, strings.NewReader(test.expected),
+			"clamav_mem_heap_bytes", "clamav_mem_mmap_bytes", "clamav_mem_used_bytes", "clamav_mem_free_bytes"))
+	}
+}
+
+func assertNoParseErrors(t *testing.T, c *ClamavCollector) {
+	for _, parser := range parsers {
+		assert.Zero(t, testutil.ToFloat64(c.parseErrors.WithLabelValues(parser)), parser)
+	}
+}
+
+// statsSections are the lines of STATS read by each parser
+var statsSections = map[string]string{
+	"state":    "STATE:",
+	"threads":  "THREADS:",
+	"memstats": "MEMSTATS:",
+	"queue":    "QUEUE:",
+	"pools":    "POOLS:",
+}
+
+func TestParseThreads(t *testing.T) {
+	parsed, ok := parseThreads(clamavtest.DefaultStats)
+	assert.True(t, ok)
+	assert.Equal(t, threads{live: "1", idle: "0", max: "12"}, parsed)
+
+	for _, stats := range []string{"", "THREADS: live 1\nEND", "THREADS: live N/A idle 0 max 12\nEND"} {
+		_, ok = parseThreads(stats)
+		assert.False(t, ok, stats)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	c := newTestCollector(server)
+
+	testutil.CollectAndCount(c)
+	assertNoParseErrors(t, c)
+
+	// Sections present but unparsable are counted, missing sections are not
+	server.SetReply("STATS", "POOLS: many\n\nSTATE: BROKEN\nTHREADS: live 1\nQUEUE: garbage\nMEMSTATS: garbage\nEND")
+	server.SetReply("VERSION", "garbage")
+	testutil.CollectAndCount(c)
+	for _, parser := range parsers {
+		assert.Equal(t, 1.0, testutil.ToFloat64(c.parseErrors.WithLabelValues(parser)), parser)
+	}
+
+	server.SetReply("STATS", "END")
+	server.SetReply("VERSION", clamavtest.DefaultVersion)
+	testutil.CollectAndCount(c)
+	for _, parser := range parsers {
+		assert.Equal(t, 1.0, testutil.ToFloat64(c.parseErrors.WithLabelValues(parser)), parser)
+	}
+}
+
+func FuzzStats(f *testing.F) {
+	f.Add(clamavtest.DefaultStats)
+	stats, _ := filepath.Glob(filepath.Join("testdata", "clamd", "*", "stats.txt"))
+	for _, file := range stats {
+		reply, err := os.ReadFile(file)
+		assert.NoError(f, err)
+		f.Add(string(reply))
+	}
+
+	out := log.StandardLogger().Out
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(out) })
+
+	f.Fuzz(func(t *testing.T, stats string) {
+		c := newTestCollector(&clamavtest.Server{})
+		collectParsed(t, func(ch chan<- prometheus.Metric) {
+			c.CollectState(ch, true, stats)
+			c.CollectMemoryStats(ch, stats)
+			c.CollectThreads(ch, stats)
+			c.CollectQueue(ch, stats)
+			c.CollectPools(ch, stats)
+		})
+		for parser, section := range statsSections {
+			if !strings.Contains(stats, section) {
+				assert.Zero(t, testutil.ToFloat64(c.parseErrors.WithLabelValues(parser)), parser)
+			}
+		}
+	})
+}
+
+func FuzzVersion(f *testing.F) {
+	f.Add(clamavtest.DefaultVersion)
+	f.Add("ClamAV 1.0.7/27400/Mon Sep  2 08:27:14 2024\x00")
+	versions, _ := filepath.Glob(filepath.Join("testdata", "clamd", "*", "version.txt"))
+	for _, file := range versions {
+		reply, err := os.ReadFile(file)
+		assert.NoError(f, err)
+		f.Add(string(reply))
+	}
+
+	out := log.StandardLogger().Out
+	log.SetOutput(io.Discard)
+	f.Cleanup(func() { log.SetOutput(out) })
+
+	database := regexp.MustCompile(`^\d+$`)
+	f.Fuzz(func(t *testing.T, version string) {
+		if parsed, ok := clamav.ParseVersion([]byte(version)); ok {
+			assert.Regexp(t, database, parsed.Database)
+		} else {
+			assert.Equal(t, clamav.Version{}, parsed)
+		}
+
+		c := newTestCollector(&clamavtest.Server{})
+		collectParsed(t, func(ch chan<- prometheus.Metric) {
+			c.CollectBuildInfo(ch, version)
+		})
+		if _, ok := clamav.ParseVersion([]byte(version)); ok {
+			assert.Zero(t, testutil.ToFloat64(c.parseErrors.WithLabelValues("version")))
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamdconf"
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults of ClamAV 1.x for the limits which aren't set in clamd.conf
+const (
+	defaultMaxThreads      = 10
+	defaultMaxQueue        = 100
+	defaultMaxScanSize     = 400 << 20
+	defaultStreamMaxLength = 100 << 20
+)
+
+// limits are the settings of clamd.conf compared with the usage reported by STATS
+type limits struct {
+	maxThreads               int64
+	maxQueue                 int64
+	maxScanSize              int64
+	streamMaxLength          int64
+	concurrentDatabaseReload bool
+}
+
+// readLimits reads the limits of config, keeping the default of invalid values
+func readLimits(config *clamdconf.Config) limits {
+	var l limits
+	var err error
+	warn := func(err error) {
+		if err != nil {
+			log.Warn("Error reading clamd configuration: ", err)
+		}
+	}
+	l.maxThreads, err = config.Int("MaxThreads", defaultMaxThreads)
+	warn(err)
+	l.maxQueue, err = config.Int("MaxQueue", defaultMaxQueue)
+	warn(err)
+	l.maxScanSize, err = config.Size("MaxScanSize", defaultMaxScanSize)
+	warn(err)
+	l.streamMaxLength, err = config.Size("StreamMaxLength", defaultStreamMaxLength)
+	warn(err)
+	l.concurrentDatabaseReload, err = config.Bool("ConcurrentDatabaseReload", true)
+	warn(err)
+	return l
+}
+
+// ConfigCollector satisfies prometheus.Collector interface, exporting the limits of clamd.conf
+type ConfigCollector struct {
+	mu     sync.RWMutex
+	limits limits
+
+	maxThreads               *prometheus.Desc
+	maxQueue                 *prometheus.Desc
+	maxScanSize              *prometheus.Desc
+	streamMaxLength          *prometheus.Desc
+	concurrentDatabaseReload *prometheus.Desc
+}
+
+// NewConfigCollector creates a ConfigCollector struct
+func NewConfigCollector(config *clamdconf.Config) *ConfigCollector {
+	return &ConfigCollector{
+		limits:                   readLimits(config),
+		maxThreads:               prometheus.NewDesc("clamav_config_max_threads", "Shows MaxThreads of clamd.conf", nil, nil),
+		maxQueue:                 prometheus.NewDesc("clamav_config_max_queue", "Shows MaxQueue of clamd.conf", nil, nil),
+		maxScanSize:              prometheus.NewDesc("clamav_config_max_scan_size_bytes", "Shows MaxScanSize of clamd.conf in bytes, 0 is unlimited", nil, nil),
+		streamMaxLength:          prometheus.NewDesc("clamav_config_stream_max_length_bytes", "Shows StreamMaxLength of clamd.conf in bytes", nil, nil),
+		concurrentDatabaseReload: prometheus.NewDesc("clamav_config_concurrent_database_reload", "Shows if ConcurrentDatabaseReload of clamd.conf is enabled", nil, nil),
+	}
+}
+
+// SetConfig replaces the configuration, e.g. when clamd.conf changed
+func (collector *ConfigCollector) SetConfig(config *clamdconf.Config) {
+	l := readLimits(config)
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.limits = l
+}
+
+func (collector *ConfigCollector) current() limits {
+	collector.mu.RLock()
+	defer collector.mu.RUnlock()
+	return collector.limits
+}
+
+// Describe satisfies prometheus.Collector.Describe
+func (collector *ConfigCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.maxThreads
+	ch <- collector.maxQueue
+	ch <- collector.maxScanSize
+	ch <- collector.streamMaxLength
+	ch <- collector.concurrentDatabaseReload
+}
+
+// Collect satisfies prometheus.Collector.Collect
+func (collector *ConfigCollector) Collect(ch chan<- prometheus.Metric) {
+	l := collector.current()
+	ch <- prometheus.MustNewConstMetric(collector.maxThreads, prometheus.GaugeValue, float64(l.maxThreads))
+	ch <- prometheus.MustNewConstMetric(collector.maxQueue, prometheus.GaugeValue, float64(l.maxQueue))
+	ch <- prometheus.MustNewConstMetric(collector.maxScanSize, prometheus.GaugeValue, float64(l.maxScanSize))
+	ch <- prometheus.MustNewConstMetric(collector.streamMaxLength, prometheus.GaugeValue, float64(l.streamMaxLength))
+	if l.concurrentDatabaseReload {
+		ch <- prometheus.MustNewConstMetric(collector.concurrentDatabaseReload, prometheus.GaugeValue, 1)
+	} else {
+		ch <- prometheus.MustNewConstMetric(collector.concurrentDatabaseReload, prometheus.GaugeValue, 0)
+	}
+}
@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// timeDependentMetrics change on every run, so they are left out of the golden files
+var timeDependentMetrics = map[string]bool{
+	"clamav_database_age":     true,
+	"clamav_data_age_seconds": true,
+}
+
+// compareGolden compares the metrics of c, without time dependent metrics, with the golden file.
+// Every metric collected must be in the golden file, and every metric of the golden file must be collected.
+func compareGolden(t *testing.T, golden string, c prometheus.Collector) {
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	var names []string
+	for _, family := range families {
+		if !timeDependentMetrics[family.GetName()] {
+			names = append(names, family.GetName())
+		}
+	}
+
+	expected, err := os.Open(golden)
+	assert.NoError(t, err)
+	defer expected.Close()
+	assert.NoError(t, testutil.CollectAndCompare(c, expected, names...))
+}
+
+// TestGoldenClamd serves the replies of each directory of testdata/clamd, written by hand for a scenario or
+// recorded from a ClamAV version, and compares the metrics with its metrics.prom. Replies are recorded with e.g.
+// printf 'zSTATS\0' | nc clamd 3310 > stats.txt
+func TestGoldenClamd(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "clamd", "*"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dirs)
+
+	for _, dir := range dirs {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			server, err := clamavtest.NewServer("tcp", "")
+			assert.NoError(t, err)
+			defer server.Close()
+
+			for command, file := range map[string]string{"STATS": "stats.txt", "VERSION": "version.txt"} {
+				reply, err := os.ReadFile(filepath.Join(dir, file))
+				assert.NoError(t, err)
+				server.SetReply(command, string(reply))
+			}
+
+			compareGolden(t, filepath.Join(dir, "metrics.prom"), newTestCollector(server))
+		})
+	}
+}
+
+// TestGoldenClamscan reads the clamscan logs in testdata/clamscan and compares the metrics
+// with the golden file next to each log
+func TestGoldenClamscan(t *testing.T) {
+	logs, err := filepath.Glob(filepath.Join("testdata", "clamscan", "*.log"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, logs)
+
+	for _, log := range logs {
+		name := filepath.Base(log[:len(log)-len(filepath.Ext(log))])
+		t.Run(name, func(t *testing.T) {
+			report := clamav.NewScanReport(log)
+			assert.NoError(t, report.Read())
+
+			compareGolden(t, filepath.Join(filepath.Dir(log), name+".prom"), NewClamscanCollector(report))
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamdconf"
+)
+
+// PolicyCollector satisfies prometheus.Collector interface, exporting the settings of clamd.conf and
+// freshclam.conf which violate a policy
+type PolicyCollector struct {
+	policy *clamdconf.Policy
+
+	mu      sync.RWMutex
+	configs map[string]*clamdconf.Config
+
+	violation *prometheus.Desc
+}
+
+// NewPolicyCollector creates a PolicyCollector struct
+func NewPolicyCollector(policy *clamdconf.Policy) *PolicyCollector {
+	return &PolicyCollector{
+		policy:    policy,
+		configs:   map[string]*clamdconf.Config{},
+		violation: prometheus.NewDesc("clamav_config_policy_violation", "Shows if a setting of clamd.conf or freshclam.conf violates the policy", []string{"config", "setting"}, nil),
+	}
+}
+
+// SetConfig sets the configuration name (options: clamd, freshclam), e.g. when its file changed
+func (collector *PolicyCollector) SetConfig(name string, config *clamdconf.Config) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.configs[name] = config
+}
+
+// PolicyReport checks the configurations against the policy
+func (collector *PolicyCollector) PolicyReport() clamdconf.Report {
+	collector.mu.RLock()
+	defer collector.mu.RUnlock()
+	return clamdconf.NewReport(
+		collector.policy.Check(clamdconf.ConfigClamd, collector.configs[clamdconf.ConfigClamd]),
+		collector.policy.Check(clamdconf.ConfigFreshclam, collector.configs[clamdconf.ConfigFreshclam]),
+	)
+}
+
+// Describe satisfies prometheus.Collector.Describe
+func (collector *PolicyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.violation
+}
+
+// Collect satisfies prometheus.Collector.Collect
+func (collector *PolicyCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, result := range collector.PolicyReport().Results {
+		value := 0.0
+		if result.Violated {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(collector.violation, prometheus.GaugeValue, value, result.Config, result.Setting)
+	}
+}
@@ -0,0 +1,157 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultProcessName is the name of the clamd process
+const DefaultProcessName = "clamd"
+
+// ProcessFinder finds the clamd process in procfs. clamd must run on the same host, or in the same
+// PID namespace, e.g. in a pod with shareProcessNamespace.
+type ProcessFinder struct {
+	fs      procfs.FS
+	pidFile string
+	name    string
+}
+
+// NewProcessFinder creates a ProcessFinder. clamd is found by the PID written in pidFile,
+// or by its process name when pidFile is empty.
+func NewProcessFinder(procPath, pidFile, name string) (*ProcessFinder, error) {
+	fs, err := procfs.NewFS(procPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening procfs: %s", err)
+	}
+	return &ProcessFinder{fs: fs, pidFile: pidFile, name: name}, nil
+}
+
+// Find returns the clamd process. The PID file is read on every call, as clamd writes it again on restart.
+// Without PID file, the oldest process named after clamd is used, as clamd may fork.
+func (finder *ProcessFinder) Find() (procfs.Proc, error) {
+	if finder.pidFile != "" {
+		content, err := os.ReadFile(finder.pidFile)
+		if err != nil {
+			return procfs.Proc{}, fmt.Errorf("error reading PID file: %s", err)
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		if err != nil {
+			return procfs.Proc{}, fmt.Errorf("invalid PID file %s: %s", finder.pidFile, err)
+		}
+		return finder.fs.Proc(pid)
+	}
+
+	procs, err := finder.fs.AllProcs()
+	if err != nil {
+		return procfs.Proc{}, err
+	}
+	// AllProcs is sorted by PID
+	for _, p := range procs {
+		if comm, err := p.Comm(); err == nil && comm == finder.name {
+			return p, nil
+		}
+	}
+	return procfs.Proc{}, fmt.Errorf("no process named %s", finder.name)
+}
+
+// ProcessCollector satisfies prometheus.Collector interface, exporting the resources used by the clamd
+// process from procfs
+type ProcessCollector struct {
+	finder *ProcessFinder
+
+	mu     sync.RWMutex
+	target string
+
+	up             *prometheus.Desc
+	cpuTime        *prometheus.Desc
+	residentMemory *prometheus.Desc
+	virtualMemory  *prometheus.Desc
+	openFDs        *prometheus.Desc
+	maxFDs         *prometheus.Desc
+	threads        *prometheus.Desc
+	startTime      *prometheus.Desc
+}
+
+// NewProcessCollector creates a ProcessCollector struct, with metrics labeled by target
+func NewProcessCollector(finder *ProcessFinder, target string) *ProcessCollector {
+	labels := []string{"target"}
+	return &ProcessCollector{
+		finder:         finder,
+		target:         target,
+		up:             prometheus.NewDesc("clamav_process_up", "Shows if the ClamAV process is found", labels, nil),
+		cpuTime:        prometheus.NewDesc("clamav_process_cpu_seconds_total", "Total user and system CPU time of the ClamAV process in seconds", labels, nil),
+		residentMemory: prometheus.NewDesc("clamav_process_resident_memory_bytes", "Resident memory size of the ClamAV process in bytes", labels, nil),
+		virtualMemory:  prometheus.NewDesc("clamav_process_virtual_memory_bytes", "Virtual memory size of the ClamAV process in bytes", labels, nil),
+		openFDs:        prometheus.NewDesc("clamav_process_open_fds", "Number of open file descriptors of the ClamAV process", labels, nil),
+		maxFDs:         prometheus.NewDesc("clamav_process_max_fds", "Maximum number of open file descriptors of the ClamAV process", labels, nil),
+		threads:        prometheus.NewDesc("clamav_process_threads", "Number of OS threads of the ClamAV process", labels, nil),
+		startTime:      prometheus.NewDesc("clamav_process_start_time_seconds", "Start time of the ClamAV process since unix epoch in seconds", labels, nil),
+	}
+}
+
+// SetTarget changes the target label, e.g. when clamd.conf changed
+func (collector *ProcessCollector) SetTarget(target string) {
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.target = target
+}
+
+// Describe satisfies prometheus.Collector.Describe
+func (collector *ProcessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.up
+	ch <- collector.cpuTime
+	ch <- collector.residentMemory
+	ch <- collector.virtualMemory
+	ch <- collector.openFDs
+	ch <- collector.maxFDs
+	ch <- collector.threads
+	ch <- collector.startTime
+}
+
+// Collect satisfies prometheus.Collector.Collect
+func (collector *ProcessCollector) Collect(ch chan<- prometheus.Metric) {
+	collector.mu.RLock()
+	target := collector.target
+	collector.mu.RUnlock()
+
+	p, err := collector.finder.Find()
+	if err == nil {
+		var stat procfs.ProcStat
+		if stat, err = p.Stat(); err == nil {
+			ch <- prometheus.MustNewConstMetric(collector.up, prometheus.GaugeValue, 1, target)
+			ch <- prometheus.MustNewConstMetric(collector.cpuTime, prometheus.CounterValue, stat.CPUTime(), target)
+			ch <- prometheus.MustNewConstMetric(collector.residentMemory, prometheus.GaugeValue, float64(stat.ResidentMemory()), target)
+			ch <- prometheus.MustNewConstMetric(collector.virtualMemory, prometheus.GaugeValue, float64(stat.VirtualMemory()), target)
+			ch <- prometheus.MustNewConstMetric(collector.threads, prometheus.GaugeValue, float64(stat.NumThreads), target)
+			if startTime, err := stat.StartTime(); err == nil {
+				ch <- prometheus.MustNewConstMetric(collector.startTime, prometheus.GaugeValue, startTime, target)
+			} else {
+				log.Debug("Error reading ClamAV process start time: ", err)
+			}
+		}
+	}
+	if err != nil {
+		log.Debug("ClamAV process not found: ", err)
+		ch <- prometheus.MustNewConstMetric(collector.up, prometheus.GaugeValue, 0, target)
+		return
+	}
+
+	// The file descriptors of another user's process can't be read without privileges
+	if fds, err := p.FileDescriptorsLen(); err == nil {
+		ch <- prometheus.MustNewConstMetric(collector.openFDs, prometheus.GaugeValue, float64(fds), target)
+	} else {
+		log.Debug("Error reading ClamAV process file descriptors: ", err)
+	}
+	if limits, err := p.Limits(); err == nil {
+		ch <- prometheus.MustNewConstMetric(collector.maxFDs, prometheus.GaugeValue, float64(limits.OpenFiles), target)
+	} else {
+		log.Debug("Error reading ClamAV process limits: ", err)
+	}
+}
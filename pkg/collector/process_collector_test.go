@@ -0,0 +1,51 @@
+//go:build linux
+
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/procfs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessCollector(t *testing.T) {
+	self, err := procfs.Self()
+	assert.NoError(t, err)
+	name, err := self.Comm()
+	assert.NoError(t, err)
+
+	pidFile := filepath.Join(t.TempDir(), "clamd.pid")
+	assert.NoError(t, os.WriteFile(pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644))
+
+	for _, c := range []struct{ pidFile, name string }{{pidFile: pidFile}, {name: name}} {
+		finder, err := NewProcessFinder(procfs.DefaultMountPoint, c.pidFile, c.name)
+		assert.NoError(t, err)
+		collector := NewProcessCollector(finder, "tcp://localhost:3310")
+
+		expected := `
+# HELP clamav_process_up Shows if the ClamAV process is found
+# TYPE clamav_process_up gauge
+clamav_process_up{target="tcp://localhost:3310"} 1
+`
+		assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), "clamav_process_up"))
+		// The test process has threads, open files and memory
+		assert.Equal(t, 8, testutil.CollectAndCount(collector))
+	}
+
+	finder, err := NewProcessFinder(procfs.DefaultMountPoint, filepath.Join(t.TempDir(), "missing.pid"), "")
+	assert.NoError(t, err)
+	collector := NewProcessCollector(finder, "tcp://localhost:3310")
+	collector.SetTarget("unix:///run/clamav/clamd.ctl")
+	expected := `
+# HELP clamav_process_up Shows if the ClamAV process is found
+# TYPE clamav_process_up gauge
+clamav_process_up{target="unix:///run/clamav/clamd.ctl"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+}
@@ -18,6 +18,21 @@ type ClamscanCollector struct {
 	lastScanErrors        *prometheus.Desc
 }
 
+// NewClamscanCollector creates a ClamscanCollector struct
+func NewClamscanCollector(report *clamav.ScanReport) *ClamscanCollector {
+	return &ClamscanCollector{
+		clamScanReport:        report,
+		up:                    prometheus.NewDesc("clamscan_report_file", "Shows if report file is found", []string{"file_path"}, nil),
+		countLine:             prometheus.NewDesc("clamscan_report_file_count_line", "DEBUG: Shows how many line has been read report file", []string{"type"}, nil),
+		lastScanStartTime:     prometheus.NewDesc("clamscan_report_start_time", "Timestamp's start of last scan", nil, nil),
+		lastScanEndTime:       prometheus.NewDesc("clamscan_report_end_time", "Timestamp's end of last scan", nil, nil),
+		lastScanDuration:      prometheus.NewDesc("clamscan_report_duration", "Time duration of last scan in seconds", nil, nil),
+		lastScanStatus:        prometheus.NewDesc("clamscan_report_status", "Last scan status", nil, nil),
+		lastScanInfectedFiles: prometheus.NewDesc("clamscan_report_infected_files", "Last scan count infected files", nil, nil),
+		lastScanErrors:        prometheus.NewDesc("clamscan_report_errors", "Last scan count errors", nil, nil),
+	}
+}
+
 // Describe satisfies prometheus.Collector.Describe
 func (collector *ClamscanCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- collector.up
@@ -32,7 +47,8 @@ func (collector *ClamscanCollector) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect satisfies prometheus.Collector.Collect
 func (collector *ClamscanCollector) Collect(ch chan<- prometheus.Metric) {
-	if collector.clamScanReport.GetFilepath() == "" {
+	// Without report file, the results may come from scans scheduled by the exporter
+	if collector.clamScanReport.GetFilepath() == "" && !collector.clamScanReport.HasResults() {
 		ch <- prometheus.MustNewConstMetric(collector.up, prometheus.GaugeValue, 0, "")
 		return
 	}
@@ -47,6 +63,7 @@ func (collector *ClamscanCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(collector.countLine, prometheus.GaugeValue, float64(collector.clamScanReport.GetParsedLineCount()), "parsed")
 	ch <- prometheus.MustNewConstMetric(collector.countLine, prometheus.GaugeValue, float64(collector.clamScanReport.GetIgnoredLineCount()), "ignored")
 	ch <- prometheus.MustNewConstMetric(collector.countLine, prometheus.GaugeValue, float64(collector.clamScanReport.GetUnknownLineCount()), "unknown")
+	ch <- prometheus.MustNewConstMetric(collector.countLine, prometheus.GaugeValue, float64(collector.clamScanReport.GetErrorLineCount()), "error")
 	ch <- prometheus.MustNewConstMetric(collector.lastScanStartTime, prometheus.GaugeValue, float64(collector.clamScanReport.GetScanStartTime().Unix()))
 	ch <- prometheus.MustNewConstMetric(collector.lastScanEndTime, prometheus.GaugeValue, float64(collector.clamScanReport.GetScanEndTime().Unix()))
 	ch <- prometheus.MustNewConstMetric(collector.lastScanDuration, prometheus.GaugeValue, collector.clamScanReport.GetScanDuration().Seconds())
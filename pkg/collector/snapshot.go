@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
+	log "github.com/sirupsen/logrus"
+)
+
+// snapshot corresponds to the replies of clamd to the commands sent on a scrape
+type snapshot struct {
+	pong    []byte
+	stats   []byte
+	version []byte
+	time    time.Time
+}
+
+// fetch sends PING, STATS and VERSION to clamd
+func (collector *ClamavCollector) fetch() *snapshot {
+	return &snapshot{
+		pong:    collector.client.Dial(commands.PING),
+		stats:   collector.client.Dial(commands.STATS),
+		version: collector.client.Dial(commands.VERSION),
+		time:    collector.now(),
+	}
+}
+
+// SetCacheTTL enables the cache of clamd replies. During ttl, scrapes are served from the cache,
+// and concurrent scrapes share a single round-trip to clamd.
+func (collector *ClamavCollector) SetCacheTTL(ttl time.Duration) {
+	collector.cacheTTL = ttl
+}
+
+// StartPolling queries clamd every interval in the background until stop is closed.
+// Scrapes are then always served from the last replies, without waiting for clamd.
+func (collector *ClamavCollector) StartPolling(interval time.Duration, stop <-chan struct{}) {
+	collector.polling = true
+	collector.poll()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				collector.poll()
+			}
+		}
+	}()
+}
+
+func (collector *ClamavCollector) poll() {
+	s := collector.fetch()
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	collector.cached = s
+	// A poll is successful when clamd answered PING
+	if s.pong != nil {
+		collector.lastSuccessfulPoll = s.time
+	}
+}
+
+// snapshot returns the replies of clamd, from the cache when enabled and fresh enough
+func (collector *ClamavCollector) snapshot() *snapshot {
+	if collector.polling {
+		collector.mu.RLock()
+		defer collector.mu.RUnlock()
+		return collector.cached
+	}
+
+	if collector.cacheTTL <= 0 {
+		return collector.fetch()
+	}
+
+	collector.mu.RLock()
+	cached := collector.cached
+	collector.mu.RUnlock()
+	if cached != nil && collector.now().Sub(cached.time) < collector.cacheTTL {
+		log.Debug("Serving clamd replies from cache")
+		return cached
+	}
+
+	s, _, shared := collector.group.Do("clamd", func() (interface{}, error) {
+		s := collector.fetch()
+		collector.mu.Lock()
+		collector.cached = s
+		collector.mu.Unlock()
+		return s, nil
+	})
+	if shared {
+		log.Debug("Sharing clamd replies with a concurrent scrape")
+	}
+	return s.(*snapshot)
+}
@@ -0,0 +1,115 @@
+package collector
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// pings counts the round-trips to server, each one starting with PING
+func pings(server *clamavtest.Server) int {
+	count := 0
+	for _, command := range server.Requests() {
+		if command == "PING" {
+			count++
+		}
+	}
+	return count
+}
+
+// gauge returns the value of the gauge name collected from c
+func gauge(t *testing.T, c prometheus.Collector, name string) float64 {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("metric %s not found", name)
+	return 0
+}
+
+func TestCacheTTL(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	c := newTestCollector(server)
+	c.SetCacheTTL(30 * time.Second)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	assert.Equal(t, 0.0, gauge(t, c, "clamav_data_age_seconds"))
+	now = now.Add(10 * time.Second)
+	assert.Equal(t, 10.0, gauge(t, c, "clamav_data_age_seconds"))
+	assert.Equal(t, 1, pings(server), "scrapes within the TTL are served from the cache")
+
+	now = now.Add(20 * time.Second)
+	assert.Equal(t, 0.0, gauge(t, c, "clamav_data_age_seconds"))
+	assert.Equal(t, 2, pings(server), "the cache expires after the TTL")
+}
+
+func TestCacheConcurrentScrapes(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	server.SetLatency(50 * time.Millisecond)
+	c := newTestCollector(server)
+	c.SetCacheTTL(time.Minute)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			testutil.CollectAndCount(c)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, pings(server), "concurrent scrapes share a single round-trip")
+}
+
+func TestPolling(t *testing.T) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	defer server.Close()
+	c := newTestCollector(server)
+
+	stop := make(chan struct{})
+	c.StartPolling(50*time.Millisecond, stop)
+	assert.Equal(t, 1, pings(server), "the first poll is done before StartPolling returns")
+	c.mu.RLock()
+	lastSuccessfulPoll := c.lastSuccessfulPoll
+	c.mu.RUnlock()
+	assert.False(t, lastSuccessfulPoll.IsZero())
+
+	// A failed poll keeps the time of the last successful one
+	server.SetDisconnect("PING", true)
+	assert.Eventually(t, func() bool {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return c.cached.pong == nil
+	}, time.Second, 5*time.Millisecond)
+	c.mu.RLock()
+	assert.Equal(t, lastSuccessfulPoll, c.lastSuccessfulPoll)
+	c.mu.RUnlock()
+	assert.Equal(t, float64(lastSuccessfulPoll.Unix()), gauge(t, c, "clamav_last_successful_poll_timestamp_seconds"))
+
+	// Scrapes are served from the last poll, without querying clamd
+	close(stop)
+	time.Sleep(100 * time.Millisecond)
+	requests := len(server.Requests())
+	for range 3 {
+		testutil.CollectAndCount(c)
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Len(t, server.Requests(), requests, "polling stops when stop is closed")
+	assert.Equal(t, 0.0, gauge(t, c, "clamav_up"))
+}
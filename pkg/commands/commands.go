@@ -16,27 +16,59 @@ package commands
 
 import "fmt"
 
-//Command corresponds to a ClamAV command that is accepted by `clamd` over the tcp socket. See `man clamd`.
+// Command corresponds to a ClamAV command that is accepted by `clamd` over the tcp socket. See `man clamd`.
 type Command struct {
 	Name   string
 	Prefix string
+	Arg    string
+	// Idempotent commands can be sent again when they fail
+	Idempotent bool
 }
 
 var (
 	//PING - Check the server's state. It should reply with "PONG".
-	PING = Command{Name: "PING", Prefix: ""}
+	PING = Command{Name: "PING", Prefix: "", Idempotent: true}
 
 	//STATS - It is mandatory to newline terminate this command, or prefix with n or z.
 	//Replies with statistics about the scan queue, contents of scan queue, and memory usage.
-	STATS = Command{Name: "STATS", Prefix: "n"}
+	STATS = Command{Name: "STATS", Prefix: "n", Idempotent: true}
 
 	//VERSION - ClamAV version and database information
-	VERSION = Command{Name: "VERSION", Prefix: ""}
+	VERSION = Command{Name: "VERSION", Prefix: "", Idempotent: true}
+
+	//RELOAD - Reload the virus databases. It should reply with "RELOADING".
+	RELOAD = Command{Name: "RELOAD", Prefix: ""}
+
+	//INSTREAM - Scan a stream of data. The stream is sent to clamd in chunks after the command,
+	//each chunk prefixed with its length as a 4 byte unsigned integer in network byte order.
+	//A zero length chunk marks the end of the stream.
+	INSTREAM = Command{Name: "INSTREAM", Prefix: "n"}
+
+	//CONTSCAN - Scan a file or directory (recursively) with archive support enabled
+	//and don't stop the scanning when a virus is found. Use WithArg to set the path.
+	CONTSCAN = Command{Name: "CONTSCAN", Prefix: "n"}
+
+	//MULTISCAN - Scan a file or directory in a standard way using multiple threads. Use WithArg to set the path.
+	MULTISCAN = Command{Name: "MULTISCAN", Prefix: "n"}
+
+	//ALLMATCHSCAN - Like CONTSCAN but continue scanning a file after a virus is found,
+	//so every matching signature is reported. Use WithArg to set the path.
+	ALLMATCHSCAN = Command{Name: "ALLMATCHSCAN", Prefix: "n"}
 )
 
+// WithArg returns a copy of the command with its argument set, e.g. the path to scan
+func (c Command) WithArg(arg string) Command {
+	c.Arg = arg
+	return c
+}
+
 func (c Command) String() string {
+	name := c.Name
+	if c.Arg != "" {
+		name = name + " " + c.Arg
+	}
 	if c.Prefix == "n" {
-		return fmt.Sprintf("%s%s\n", c.Prefix, c.Name)
+		return fmt.Sprintf("%s%s\n", c.Prefix, name)
 	}
-	return c.Prefix + c.Name + "\n"
+	return c.Prefix + name + "\n"
 }
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	log "github.com/sirupsen/logrus"
+)
+
+// Outputs of the event log
+const (
+	OutputStdout = "stdout"
+	OutputFile   = "file"
+	OutputSyslog = "syslog"
+)
+
+// Config corresponds to the settings of the event log
+type Config struct {
+	Output string
+	// File output
+	FilePath       string
+	FileMaxSize    int64
+	FileMaxBackups int
+	// Syslog output, e.g. tcp://syslog:514, udp://syslog:514 or unix:///dev/log
+	SyslogAddress string
+}
+
+// Logger writes detections and scan summaries as JSON events, apart from the diagnostic logs
+type Logger struct {
+	logger *log.Logger
+	closer io.Closer
+}
+
+// New creates a new Logger
+func New(config Config) (*Logger, error) {
+	logger := log.New()
+	logger.SetFormatter(&log.JSONFormatter{})
+	logger.SetLevel(log.InfoLevel)
+
+	var closer io.Closer
+	switch config.Output {
+	case OutputStdout:
+		logger.SetOutput(os.Stdout)
+	case OutputFile:
+		file, err := newRotatingFile(config.FilePath, config.FileMaxSize, config.FileMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		logger.SetOutput(file)
+		closer = file
+	case OutputSyslog:
+		hook, err := newSyslogHook(config.SyslogAddress)
+		if err != nil {
+			return nil, err
+		}
+		logger.SetOutput(io.Discard)
+		logger.AddHook(hook)
+		closer = hook
+	default:
+		return nil, fmt.Errorf("unknown event log output %q (options: stdout, file, syslog)", config.Output)
+	}
+
+	return &Logger{logger: logger, closer: closer}, nil
+}
+
+// OnDetection satisfies clamav.Listener
+func (l *Logger) OnDetection(d clamav.Detection) {
+	l.logger.WithFields(log.Fields{
+		"event":     "detection",
+		"source":    d.Source,
+		"path":      d.Path,
+		"signature": d.Signature,
+		"detected":  d.Time,
+	}).Warn("ClamAV detection")
+}
+
+// OnSummary satisfies clamav.Listener
+func (l *Logger) OnSummary(s clamav.Summary) {
+	l.logger.WithFields(log.Fields{
+		"event":            "summary",
+		"source":           s.Source,
+		"infected_files":   s.InfectedFiles,
+		"total_errors":     s.TotalErrors,
+		"duration_seconds": s.Duration.Seconds(),
+		"start_time":       s.StartTime,
+		"end_time":         s.EndTime,
+	}).Info("ClamAV scan summary")
+}
+
+// Close closes the file or syslog connection
+func (l *Logger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
@@ -0,0 +1,69 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	logger, err := New(Config{Output: OutputFile, FilePath: path, FileMaxSize: 200, FileMaxBackups: 2})
+	assert.NoError(t, err)
+	defer logger.Close()
+
+	for i := 0; i < 5; i++ {
+		logger.OnDetection(clamav.Detection{Source: clamav.SourceStream, Path: "stream", Signature: "Eicar-Test-Signature", Time: time.Now()})
+	}
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var event map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(strings.Split(string(content), "\n")[0]), &event))
+	assert.Equal(t, "detection", event["event"])
+	assert.Equal(t, "Eicar-Test-Signature", event["signature"])
+
+	assert.FileExists(t, path+".1")
+	assert.FileExists(t, path+".2")
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestSyslog(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	messages := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('}')
+		messages <- line
+	}()
+
+	logger, err := New(Config{Output: OutputSyslog, SyslogAddress: "tcp://" + listener.Addr().String()})
+	assert.NoError(t, err)
+	defer logger.Close()
+
+	logger.OnSummary(clamav.Summary{Source: clamav.SourceClamscan, InfectedFiles: 1})
+
+	select {
+	case msg := <-messages:
+		// Octet count, PRI of local0.notice, version 1 and the summary MSGID
+		assert.Regexp(t, regexp.MustCompile(`^\d+ <133>1 \S+ \S+ clamav-prometheus-exporter \d+ summary - \{`), msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no syslog message received")
+	}
+}
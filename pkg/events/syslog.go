@@ -0,0 +1,146 @@
+package events
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// syslogFacility is local0
+	syslogFacility = 16
+	syslogAppName  = "clamav-prometheus-exporter"
+)
+
+// syslogHook sends every log entry as a RFC 5424 message over tcp, udp or a unix socket
+type syslogHook struct {
+	network  string
+	address  string
+	hostname string
+
+	conn net.Conn
+	mu   sync.Mutex
+}
+
+func newSyslogHook(rawAddress string) (*syslogHook, error) {
+	u, err := url.Parse(rawAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid syslog address %q: %s", rawAddress, err)
+	}
+
+	hook := &syslogHook{network: u.Scheme, address: u.Host}
+	switch u.Scheme {
+	case "tcp", "udp":
+	case "unix":
+		// /dev/log is usually a datagram socket
+		hook.network = "unixgram"
+		hook.address = u.Path
+	default:
+		return nil, fmt.Errorf("invalid syslog address %q (schemes: tcp, udp, unix)", rawAddress)
+	}
+
+	hook.hostname, err = os.Hostname()
+	if err != nil {
+		hook.hostname = "-"
+	}
+
+	if err = hook.connect(); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+func (h *syslogHook) connect() error {
+	conn, err := net.DialTimeout(h.network, h.address, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("error connecting to syslog: %s", err)
+	}
+	h.conn = conn
+	return nil
+}
+
+// Levels satisfies log.Hook
+func (h *syslogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire satisfies log.Hook
+func (h *syslogHook) Fire(entry *log.Entry) error {
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA MSG
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		syslogFacility*8+severity(entry.Level),
+		entry.Time.Format(time.RFC3339Nano),
+		h.hostname,
+		syslogAppName,
+		os.Getpid(),
+		msgID(entry),
+		strings.TrimSuffix(line, "\n"),
+	)
+	if h.network == "tcp" {
+		// Octet counting framing of RFC 6587
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conn != nil {
+		if _, err = h.conn.Write([]byte(msg)); err == nil {
+			return nil
+		}
+		h.conn.Close()
+		h.conn = nil
+	}
+
+	// Reconnect once, e.g. after a restart of the syslog server
+	if err = h.connect(); err != nil {
+		return err
+	}
+	_, err = h.conn.Write([]byte(msg))
+	return err
+}
+
+// Close satisfies io.Closer
+func (h *syslogHook) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.conn == nil {
+		return nil
+	}
+	return h.conn.Close()
+}
+
+func severity(level log.Level) int {
+	switch level {
+	case log.PanicLevel:
+		return 0
+	case log.FatalLevel:
+		return 2
+	case log.ErrorLevel:
+		return 3
+	case log.WarnLevel:
+		return 4
+	case log.InfoLevel:
+		return 5
+	default:
+		return 7
+	}
+}
+
+func msgID(entry *log.Entry) string {
+	if event, ok := entry.Data["event"].(string); ok && event != "" {
+		return event
+	}
+	return "-"
+}
@@ -0,0 +1,238 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	log "github.com/sirupsen/logrus"
+)
+
+// Payload formats of a Webhook
+const (
+	FormatGeneric      = "generic"
+	FormatSlack        = "slack"
+	FormatAlertmanager = "alertmanager"
+)
+
+// Webhook corresponds to an URL notified of detections
+type Webhook struct {
+	Format string
+	URL    string
+}
+
+// ParseWebhook parses a webhook in the format=url form, e.g. slack=https://hooks.slack.com/services/...
+// Without format, the generic format is used.
+func ParseWebhook(s string) (Webhook, error) {
+	webhook := Webhook{Format: FormatGeneric, URL: s}
+	if format, rawURL, ok := strings.Cut(s, "="); ok && !strings.Contains(format, "/") {
+		webhook = Webhook{Format: strings.ToLower(format), URL: rawURL}
+	}
+
+	switch webhook.Format {
+	case FormatGeneric, FormatSlack, FormatAlertmanager:
+	default:
+		return Webhook{}, fmt.Errorf("unknown webhook format %q (options: generic, slack, alertmanager)", webhook.Format)
+	}
+
+	if u, err := url.Parse(webhook.URL); err != nil || u.Host == "" {
+		return Webhook{}, fmt.Errorf("invalid webhook URL %q", webhook.URL)
+	}
+	return webhook, nil
+}
+
+// name identifies the webhook in metrics without leaking the secrets usually contained in its path
+func (w Webhook) name() string {
+	u, _ := url.Parse(w.URL)
+	return w.Format + "/" + u.Host
+}
+
+// event is either a detection or a summary
+type event struct {
+	key       string
+	detection *clamav.Detection
+	summary   *clamav.Summary
+}
+
+// Notifier sends detections and summaries with infected files to webhooks
+type Notifier struct {
+	webhooks    []Webhook
+	client      *http.Client
+	dedupWindow time.Duration
+	retries     int
+	backoff     time.Duration
+
+	seen   map[string]time.Time
+	mu     sync.Mutex
+	events chan event
+
+	deliveries *prometheus.CounterVec
+	lastStatus *prometheus.GaugeVec
+}
+
+// New creates a new Notifier. Identical events are only sent once per dedupWindow,
+// failed deliveries are retried up to retries times with an exponential backoff.
+func New(webhooks []Webhook, dedupWindow time.Duration, retries int, backoff time.Duration) *Notifier {
+	return &Notifier{
+		webhooks:    webhooks,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		dedupWindow: dedupWindow,
+		retries:     retries,
+		backoff:     backoff,
+		seen:        map[string]time.Time{},
+		events:      make(chan event, 100),
+		deliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "clamav_webhook_deliveries_total",
+			Help: "Counts webhook deliveries by webhook and status",
+		}, []string{"webhook", "status"}),
+		lastStatus: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "clamav_webhook_last_delivery_success",
+			Help: "Shows if the last delivery to the webhook succeeded",
+		}, []string{"webhook"}),
+	}
+}
+
+// Start sends the events in the background
+func (n *Notifier) Start() {
+	go func() {
+		for e := range n.events {
+			for _, webhook := range n.webhooks {
+				n.deliver(webhook, e)
+			}
+		}
+	}()
+}
+
+// OnDetection satisfies clamav.Listener
+func (n *Notifier) OnDetection(d clamav.Detection) {
+	n.enqueue(event{key: "detection|" + d.Source + "|" + d.Path + "|" + d.Signature, detection: &d})
+}
+
+// OnSummary satisfies clamav.Listener. Only summaries with infected files are sent.
+func (n *Notifier) OnSummary(s clamav.Summary) {
+	if s.InfectedFiles == 0 {
+		return
+	}
+	n.enqueue(event{key: "summary|" + s.Source + "|" + s.EndTime.String(), summary: &s})
+}
+
+func (n *Notifier) enqueue(e event) {
+	n.mu.Lock()
+	now := time.Now()
+	for key, t := range n.seen {
+		if now.Sub(t) > n.dedupWindow {
+			delete(n.seen, key)
+		}
+	}
+	if _, ok := n.seen[e.key]; ok {
+		n.mu.Unlock()
+		log.Debug("Duplicated webhook event: ", e.key)
+		return
+	}
+	n.seen[e.key] = now
+	n.mu.Unlock()
+
+	select {
+	case n.events <- e:
+	default:
+		log.Error("Webhook queue is full, dropping event: ", e.key)
+		for _, webhook := range n.webhooks {
+			n.deliveries.WithLabelValues(webhook.name(), "dropped").Inc()
+		}
+	}
+}
+
+func (n *Notifier) deliver(webhook Webhook, e event) {
+	body, err := payload(webhook.Format, e)
+	if err != nil {
+		log.Error("Error creating webhook payload: ", err)
+		return
+	}
+
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			// Exponential backoff with up to 50% jitter
+			delay := n.backoff << (attempt - 1)
+			delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+			time.Sleep(delay)
+		}
+
+		if err = n.post(webhook.URL, body); err == nil {
+			n.deliveries.WithLabelValues(webhook.name(), "success").Inc()
+			n.lastStatus.WithLabelValues(webhook.name()).Set(1)
+			return
+		}
+		log.Warnf("Error delivering webhook %s (attempt %d): %s", webhook.name(), attempt+1, err)
+	}
+
+	log.Error("Giving up delivering webhook ", webhook.name())
+	n.deliveries.WithLabelValues(webhook.name(), "failure").Inc()
+	n.lastStatus.WithLabelValues(webhook.name()).Set(0)
+}
+
+func (n *Notifier) post(url string, body []byte) error {
+	resp, err := n.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func payload(format string, e event) ([]byte, error) {
+	switch format {
+	case FormatSlack:
+		return json.Marshal(map[string]string{"text": text(e)})
+	case FormatAlertmanager:
+		labels := map[string]string{"severity": "critical"}
+		if e.detection != nil {
+			labels["alertname"] = "ClamAVDetection"
+			labels["source"] = e.detection.Source
+			labels["path"] = e.detection.Path
+			labels["signature"] = e.detection.Signature
+		} else {
+			labels["alertname"] = "ClamAVInfectedFiles"
+			labels["source"] = e.summary.Source
+		}
+		return json.Marshal([]map[string]interface{}{{
+			"labels":      labels,
+			"annotations": map[string]string{"summary": text(e)},
+			"startsAt":    time.Now().UTC().Format(time.RFC3339),
+		}})
+	default:
+		if e.detection != nil {
+			return json.Marshal(map[string]interface{}{"type": "detection", "detection": e.detection})
+		}
+		return json.Marshal(map[string]interface{}{"type": "summary", "summary": e.summary})
+	}
+}
+
+func text(e event) string {
+	if e.detection != nil {
+		return fmt.Sprintf("ClamAV found %s in %s (%s)", e.detection.Signature, e.detection.Path, e.detection.Source)
+	}
+	return fmt.Sprintf("ClamAV scan finished with %d infected files and %d errors (%s)", e.summary.InfectedFiles, e.summary.TotalErrors, e.summary.Source)
+}
+
+// Describe satisfies prometheus.Collector.Describe
+func (n *Notifier) Describe(ch chan<- *prometheus.Desc) {
+	n.deliveries.Describe(ch)
+	n.lastStatus.Describe(ch)
+}
+
+// Collect satisfies prometheus.Collector.Collect
+func (n *Notifier) Collect(ch chan<- prometheus.Metric) {
+	n.deliveries.Collect(ch)
+	n.lastStatus.Collect(ch)
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifier(t *testing.T) {
+	var calls atomic.Int32
+	bodies := make(chan map[string]string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first delivery fails to test retries
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	webhook, err := ParseWebhook("slack=" + server.URL)
+	assert.NoError(t, err)
+
+	notifier := New([]Webhook{webhook}, time.Hour, 2, time.Millisecond)
+	notifier.Start()
+
+	detection := clamav.Detection{Source: clamav.SourceClamscan, Path: "/host-fs/eicar.com", Signature: "Eicar-Test-Signature"}
+	notifier.OnDetection(detection)
+	// Duplicated detection is ignored
+	notifier.OnDetection(detection)
+	// Summary without infected files is ignored
+	notifier.OnSummary(clamav.Summary{Source: clamav.SourceClamscan})
+
+	select {
+	case body := <-bodies:
+		assert.Equal(t, "ClamAV found Eicar-Test-Signature in /host-fs/eicar.com (clamscan)", body["text"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(notifier.deliveries.WithLabelValues(webhook.name(), "success")) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Len(t, bodies, 0)
+}
+
+func TestParseWebhook(t *testing.T) {
+	webhook, err := ParseWebhook("https://example.org/hook?a=b")
+	assert.NoError(t, err)
+	assert.Equal(t, Webhook{Format: FormatGeneric, URL: "https://example.org/hook?a=b"}, webhook)
+
+	_, err = ParseWebhook("teams=https://example.org/hook")
+	assert.Error(t, err)
+}
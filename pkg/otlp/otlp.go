@@ -0,0 +1,90 @@
+package otlp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	otelprometheus "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// Config corresponds to the settings of the OTLP export
+type Config struct {
+	// Endpoint is the URL of the OTLP receiver, e.g. http://otel-collector:4318/v1/metrics for http
+	// or http://otel-collector:4317 for grpc. A https scheme enables TLS.
+	Endpoint string
+	// Protocol is either http or grpc
+	Protocol string
+	Interval time.Duration
+	// ServiceVersion and ClamdTarget are exported as resource attributes. The resource doesn't change,
+	// so ClamdTarget stays the target at startup when clamd.conf changes it.
+	ServiceVersion string
+	ClamdTarget    string
+}
+
+// Exporter periodically pushes the metrics of a prometheus.Gatherer to an OTLP receiver
+type Exporter struct {
+	provider *metric.MeterProvider
+}
+
+// New creates and starts a new Exporter
+func New(ctx context.Context, config Config, gatherer prometheus.Gatherer) (*Exporter, error) {
+	var exporter metric.Exporter
+	var err error
+	switch strings.ToLower(config.Protocol) {
+	case "http":
+		exporter, err = otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(config.Endpoint))
+	case "grpc":
+		exporter, err = otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpointURL(config.Endpoint))
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q (options: http, grpc)", config.Protocol)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP exporter: %s", err)
+	}
+
+	res, err := newResource(config)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := metric.NewPeriodicReader(exporter,
+		metric.WithInterval(config.Interval),
+		metric.WithProducer(otelprometheus.NewMetricProducer(otelprometheus.WithGatherer(gatherer))),
+	)
+
+	return &Exporter{
+		provider: metric.NewMeterProvider(metric.WithReader(reader), metric.WithResource(res)),
+	}, nil
+}
+
+func newResource(config Config) (*resource.Resource, error) {
+	attributes := []attribute.KeyValue{
+		attribute.String("service.name", "clamav-prometheus-exporter"),
+		attribute.String("service.version", config.ServiceVersion),
+		attribute.String("clamav.target", config.ClamdTarget),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		attributes = append(attributes, attribute.String("host.name", hostname))
+	}
+
+	// Attributes from OTEL_RESOURCE_ATTRIBUTES take precedence
+	res, err := resource.Merge(resource.NewSchemaless(attributes...), resource.Environment())
+	if err != nil {
+		return nil, fmt.Errorf("error creating OTLP resource: %s", err)
+	}
+	return res, nil
+}
+
+// Shutdown pushes the metrics one last time and stops the Exporter
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	return e.provider.Shutdown(ctx)
+}
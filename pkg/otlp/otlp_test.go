@@ -0,0 +1,108 @@
+package otlp
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/collector"
+	"github.com/stretchr/testify/assert"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+type grpcReceiver struct {
+	collectormetrics.UnimplementedMetricsServiceServer
+	requests chan *collectormetrics.ExportMetricsServiceRequest
+}
+
+func (r *grpcReceiver) Export(_ context.Context, req *collectormetrics.ExportMetricsServiceRequest) (*collectormetrics.ExportMetricsServiceResponse, error) {
+	r.requests <- req
+	return &collectormetrics.ExportMetricsServiceResponse{}, nil
+}
+
+func newHTTPReceiver(t *testing.T, requests chan *collectormetrics.ExportMetricsServiceRequest) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request: %s", err)
+			return
+		}
+		req := &collectormetrics.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Errorf("failed to decode request: %s", err)
+			return
+		}
+		requests <- req
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/v1/metrics"
+}
+
+func newGRPCReceiver(t *testing.T, requests chan *collectormetrics.ExportMetricsServiceRequest) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	collectormetrics.RegisterMetricsServiceServer(server, &grpcReceiver{requests: requests})
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+	return "http://" + listener.Addr().String()
+}
+
+func TestExporter(t *testing.T) {
+	for protocol, receiver := range map[string]func(*testing.T, chan *collectormetrics.ExportMetricsServiceRequest) string{
+		"http": newHTTPReceiver,
+		"grpc": newGRPCReceiver,
+	} {
+		t.Run(protocol, func(t *testing.T) {
+			requests := make(chan *collectormetrics.ExportMetricsServiceRequest, 10)
+			endpoint := receiver(t, requests)
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(collector.NewClamscanCollector(clamav.NewScanReport("")))
+
+			exporter, err := New(context.Background(), Config{
+				Endpoint:    endpoint,
+				Protocol:    protocol,
+				Interval:    time.Hour,
+				ClamdTarget: "localhost:3310",
+			}, registry)
+			assert.NoError(t, err)
+			// Shutdown flushes the metrics
+			assert.NoError(t, exporter.Shutdown(context.Background()))
+
+			select {
+			case req := <-requests:
+				resourceMetrics := req.GetResourceMetrics()
+				assert.Len(t, resourceMetrics, 1)
+
+				attributes := map[string]string{}
+				for _, attribute := range resourceMetrics[0].GetResource().GetAttributes() {
+					attributes[attribute.GetKey()] = attribute.GetValue().GetStringValue()
+				}
+				assert.Equal(t, "localhost:3310", attributes["clamav.target"])
+				assert.NotEmpty(t, attributes["host.name"])
+
+				var names []string
+				for _, scopeMetrics := range resourceMetrics[0].GetScopeMetrics() {
+					for _, metric := range scopeMetrics.GetMetrics() {
+						names = append(names, metric.GetName())
+					}
+				}
+				assert.Contains(t, names, "clamscan_report_file")
+			case <-time.After(10 * time.Second):
+				t.Fatal("no metrics received")
+			}
+		})
+	}
+}
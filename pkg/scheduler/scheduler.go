@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/commands"
+	log "github.com/sirupsen/logrus"
+)
+
+// Scheduler runs path scans against clamd on a cron schedule and records the results in a ScanReport
+type Scheduler struct {
+	client  clamav.Client
+	report  *clamav.ScanReport
+	command commands.Command
+	paths   []string
+	cron    *cron.Cron
+	// ctx is cancelled by Stop to interrupt a running scan
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates a new Scheduler. mode is one of contscan, multiscan or allmatchscan.
+func New(client clamav.Client, report *clamav.ScanReport, mode string, paths []string) (*Scheduler, error) {
+	var command commands.Command
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "contscan":
+		command = commands.CONTSCAN
+	case "multiscan":
+		command = commands.MULTISCAN
+	case "allmatchscan":
+		command = commands.ALLMATCHSCAN
+	default:
+		return nil, fmt.Errorf("unknown scan mode %q (options: contscan, multiscan, allmatchscan)", mode)
+	}
+
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no path to scan")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		client:  client,
+		report:  report,
+		command: command,
+		paths:   paths,
+		ctx:     ctx,
+		cancel:  cancel,
+	}, nil
+}
+
+// Start schedules the scans with a standard 5 fields cron expression (or descriptors like @daily)
+func (s *Scheduler) Start(spec string) error {
+	s.cron = cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger)))
+	if _, err := s.cron.AddFunc(spec, s.Run); err != nil {
+		return fmt.Errorf("invalid scan schedule %q: %s", spec, err)
+	}
+	s.cron.Start()
+	return nil
+}
+
+// Stop stops the schedule and waits for a running scan to complete. When ctx is done first,
+// the scan is interrupted and its remaining paths are recorded as errors.
+func (s *Scheduler) Stop(ctx context.Context) {
+	if s.cron == nil {
+		return
+	}
+	done := s.cron.Stop().Done()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn("Interrupting the running scan: ", ctx.Err())
+		s.cancel()
+		<-done
+	}
+}
+
+// Run scans every configured path once and records the results
+func (s *Scheduler) Run() {
+	log.Info("Scheduled scan is starting with ", s.command.Name)
+
+	var results []clamav.ScanResult
+	start := time.Now()
+	for _, path := range s.paths {
+		log.Debug("Scanning path: ", path)
+		reply, err := s.client.SendContext(s.ctx, s.command.WithArg(path))
+		if err != nil {
+			log.Error("Error scanning path ", path, ": ", err)
+			results = append(results, clamav.ScanResult{Path: path, Status: clamav.ScanStatusError, Message: err.Error()})
+			continue
+		}
+		results = append(results, clamav.ParseScanResults(reply)...)
+	}
+	end := time.Now()
+
+	s.report.RecordScan(results, start, end)
+	log.Info("Scheduled scan is done in ", end.Sub(start))
+}
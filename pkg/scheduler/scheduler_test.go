@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav/clamavtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestScheduler(t *testing.T, mode string, paths ...string) (*Scheduler, *clamavtest.Server, *clamav.ScanReport) {
+	server, err := clamavtest.NewServer("tcp", "")
+	assert.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+	report := clamav.NewScanReport("")
+	s, err := New(*clamav.New(server.Address, server.Network), report, mode, paths)
+	assert.NoError(t, err)
+	return s, server, report
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(clamav.Client{}, nil, "scan", []string{"/data"})
+	assert.Error(t, err)
+	_, err = New(clamav.Client{}, nil, "contscan", nil)
+	assert.Error(t, err)
+
+	s, _, _ := newTestScheduler(t, " MultiScan ", "/data")
+	assert.Error(t, s.Start("every day"))
+}
+
+func TestRun(t *testing.T) {
+	s, server, report := newTestScheduler(t, "allmatchscan", "/data", "/home")
+	server.SetReply("ALLMATCHSCAN", "/data/clean.txt: OK\n/data/eicar.com: Win.Test.EICAR_HDB-1 FOUND\n/data/eicar.com: Eicar-Signature FOUND\n")
+
+	s.Run()
+	assert.Equal(t, []string{"ALLMATCHSCAN /data", "ALLMATCHSCAN /home"}, server.Requests())
+	assert.True(t, report.HasResults())
+	assert.False(t, report.GetReportStatus())
+	assert.Equal(t, 1, report.GetInfectedFiles())
+	assert.Equal(t, 0, report.GetTotalErrors())
+
+	// A path which can't be scanned is recorded as an error
+	server.SetReply("ALLMATCHSCAN", "/data/clean.txt: OK\n")
+	server.SetDisconnect("ALLMATCHSCAN", true)
+	s.Run()
+	assert.Equal(t, 0, report.GetInfectedFiles())
+	assert.Equal(t, 2, report.GetTotalErrors())
+}
+
+func TestSchedule(t *testing.T) {
+	s, server, report := newTestScheduler(t, "contscan", "/data")
+	server.SetReply("CONTSCAN", "/data: OK\n")
+	// The scan lasts longer than the schedule interval
+	server.SetLatency(1500 * time.Millisecond)
+
+	assert.NoError(t, s.Start("@every 1s"))
+	assert.Eventually(t, func() bool { return len(server.Requests()) > 0 }, 3*time.Second, 10*time.Millisecond)
+	assert.False(t, report.HasResults())
+
+	// The next run is skipped while the scan is running
+	time.Sleep(1200 * time.Millisecond)
+	// Stop waits for the running scan
+	s.Stop(context.Background())
+	assert.True(t, report.HasResults())
+	assert.True(t, report.GetReportStatus())
+	assert.Equal(t, []string{"CONTSCAN /data"}, server.Requests())
+
+	time.Sleep(1200 * time.Millisecond)
+	assert.Len(t, server.Requests(), 1, "no scan runs after Stop")
+}
+
+func TestStopInterruptsScan(t *testing.T) {
+	s, server, report := newTestScheduler(t, "contscan", "/data", "/home")
+	server.SetReply("CONTSCAN", "/data: OK\n")
+	server.SetLatency(3 * time.Second)
+
+	assert.NoError(t, s.Start("@every 1s"))
+	assert.Eventually(t, func() bool { return len(server.Requests()) > 0 }, 3*time.Second, 10*time.Millisecond)
+
+	// Stop interrupts the scan once ctx is done, instead of waiting for clamd
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	s.Stop(ctx)
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.True(t, report.HasResults())
+	assert.Equal(t, 2, report.GetTotalErrors())
+	assert.Equal(t, []string{"CONTSCAN /data"}, server.Requests())
+}
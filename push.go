@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/clamav"
+	"github.com/shakapark/clamav-prometheus-exporter/pkg/collector"
+	log "github.com/sirupsen/logrus"
+)
+
+// Exit codes of the push subcommand
+const (
+	pushExitClean    = 0
+	pushExitInfected = 1
+	pushExitError    = 2
+)
+
+// runPush parses a finished clamscan report and pushes the clamscan metrics to a Pushgateway.
+// It returns the exit code of the process.
+func runPush(args []string) int {
+	flags := flag.NewFlagSet("push", flag.ContinueOnError)
+	pushgatewayURL := flags.String("pushgateway-url", "", "URL of the Pushgateway to push metrics to")
+	reportPath := flags.String("report-scan-path", "", "Path to the clamscan report file to parse")
+	job := flags.String("job", "clamscan", "Job grouping key of the pushed metrics")
+	instance := flags.String("instance", "", "Instance grouping key of the pushed metrics (default hostname)")
+	if err := flags.Parse(args); err != nil {
+		return pushExitError
+	}
+
+	if *pushgatewayURL == "" || *reportPath == "" {
+		log.Error("-pushgateway-url and -report-scan-path are required")
+		return pushExitError
+	}
+
+	if *instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Error("Error reading hostname: ", err)
+			return pushExitError
+		}
+		*instance = hostname
+	}
+
+	report := clamav.NewScanReport(*reportPath)
+	if err := report.Read(); err != nil {
+		log.Error("Error reading report file: ", err)
+		return pushExitError
+	}
+
+	err := push.New(*pushgatewayURL, *job).
+		Grouping("instance", *instance).
+		Collector(collector.NewClamscanCollector(report)).
+		Push()
+	if err != nil {
+		log.Error("Error pushing metrics: ", err)
+		return pushExitError
+	}
+	log.Infof("Metrics of %s pushed to %s", *reportPath, *pushgatewayURL)
+
+	if report.GetInfectedFiles() > 0 {
+		log.Warnf("Report found %d infected files", report.GetInfectedFiles())
+		return pushExitInfected
+	}
+	return pushExitClean
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// pushgateway is a fake Pushgateway recording the pushed paths and bodies
+type pushgateway struct {
+	*httptest.Server
+	status int
+
+	mu     sync.Mutex
+	pushes map[string]string
+}
+
+func newPushgateway(t *testing.T, status int) *pushgateway {
+	p := &pushgateway{status: status, pushes: map[string]string{}}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		p.mu.Lock()
+		p.pushes[r.Method+" "+r.URL.Path] = string(body)
+		p.mu.Unlock()
+		w.WriteHeader(p.status)
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestRunPush(t *testing.T) {
+	tests := []struct {
+		name     string
+		report   string
+		status   int
+		expected int
+		pushed   bool
+	}{
+		{name: "clean", report: "clean.log", status: http.StatusOK, expected: pushExitClean, pushed: true},
+		{name: "infected", report: "infected.log", status: http.StatusOK, expected: pushExitInfected, pushed: true},
+		{name: "missing report", report: "missing.log", status: http.StatusOK, expected: pushExitError},
+		{name: "pushgateway error", report: "clean.log", status: http.StatusInternalServerError, expected: pushExitError, pushed: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gateway := newPushgateway(t, test.status)
+			code := runPush([]string{
+				"-pushgateway-url", gateway.URL,
+				"-report-scan-path", filepath.Join("testdata", "clamscan", test.report),
+				"-instance", "host-1",
+			})
+			assert.Equal(t, test.expected, code)
+
+			body, pushed := gateway.pushes["PUT /metrics/job/clamscan/instance/host-1"]
+			assert.Equal(t, test.pushed, pushed)
+			if pushed {
+				assert.Contains(t, body, "clamscan_report_duration")
+			}
+		})
+	}
+
+	assert.Equal(t, pushExitError, runPush([]string{"-report-scan-path", "report.log"}))
+	assert.Equal(t, pushExitError, runPush([]string{"-unknown"}))
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// runTextfile periodically writes the metrics of gatherer to path for the textfile collector of
+// node_exporter, until a signal is received on quit.
+func runTextfile(path string, interval time.Duration, gatherer prometheus.Gatherer, quit <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Infof("Metrics are written to %s every %s", path, interval)
+	for {
+		// WriteToTextfile writes a temporary file then renames it, so node_exporter never reads a partial file
+		if err := prometheus.WriteToTextfile(path, gatherer); err != nil {
+			log.Error("Error writing textfile: ", err)
+		} else {
+			log.Debug("Metrics written to ", path)
+		}
+
+		select {
+		case <-quit:
+			log.Info("Textfile output is stopping...")
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunTextfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clamav.prom")
+
+	registry := prometheus.NewRegistry()
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "clamav_up", Help: "Shows UP Status"})
+	up.Set(1)
+	registry.MustRegister(up)
+
+	quit := make(chan os.Signal)
+	done := make(chan struct{})
+	go func() {
+		runTextfile(path, 10*time.Millisecond, registry, quit)
+		close(done)
+	}()
+
+	expected := "# HELP clamav_up Shows UP Status\n# TYPE clamav_up gauge\nclamav_up 1\n"
+	assert.Eventually(t, func() bool {
+		content, err := os.ReadFile(path)
+		return err == nil && string(content) == expected
+	}, time.Second, 5*time.Millisecond)
+
+	quit <- syscall.SIGTERM
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("runTextfile did not stop")
+	}
+}
+
+func TestRunTextfileError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clamav.prom")
+	assert.NoError(t, os.WriteFile(path, []byte("clamav_up 1\n"), 0o644))
+
+	failing := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return nil, errors.New("clamd is unreachable")
+	})
+	quit := make(chan os.Signal, 1)
+	quit <- syscall.SIGTERM
+	runTextfile(path, time.Hour, failing, quit)
+
+	// The previous file is kept and no temporary file is left behind
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "clamav_up 1\n", string(content))
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}